@@ -0,0 +1,113 @@
+// Defines how the TLS certificates of a socket are decoded and displayed
+
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+var certExpiryWarningFlag time.Duration
+var pemFlag bool
+
+// colonHex renders bytes as upper case hex pairs separated by colons, like
+// openssl does for serials and fingerprints
+func colonHex(b []byte) string {
+	pairs := make([]string, len(b))
+	for i, c := range b {
+		pairs[i] = fmt.Sprintf("%02X", c)
+	}
+	return strings.Join(pairs, ":")
+}
+
+// keyType describes the algorithm and size of the public key
+func keyType(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d bits", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ECDSA %v", key.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return cert.PublicKeyAlgorithm.String()
+	}
+}
+
+// subjectAltNames lists every SAN of the certificate, prefixed by its type
+func subjectAltNames(cert *x509.Certificate) []string {
+	var names []string
+	for _, name := range cert.DNSNames {
+		names = append(names, "DNS:"+name)
+	}
+	for _, ip := range cert.IPAddresses {
+		names = append(names, "IP:"+ip.String())
+	}
+	for _, uri := range cert.URIs {
+		names = append(names, "URI:"+uri.String())
+	}
+	for _, email := range cert.EmailAddresses {
+		names = append(names, "email:"+email)
+	}
+	return names
+}
+
+// expiryWarning returns why the certificate deserves attention at now, or ""
+func expiryWarning(cert *x509.Certificate, now time.Time) string {
+	switch {
+	case now.After(cert.NotAfter):
+		return fmt.Sprintf("expired %v", humanize.Time(cert.NotAfter))
+	case now.Before(cert.NotBefore):
+		return fmt.Sprintf("not valid until %v", humanize.Time(cert.NotBefore))
+	case certExpiryWarningFlag > 0 && cert.NotAfter.Sub(now) < certExpiryWarningFlag:
+		return fmt.Sprintf("expires %v", humanize.Time(cert.NotAfter))
+	}
+	return ""
+}
+
+// printCertificate prints the decoded certificate as rows of the table, and
+// warns on stderr if it is expired or about to. Certificates that cannot be
+// parsed are reported without failing the command.
+func (r *commandRun) printCertificate(title string, der []byte) {
+	if len(der) == 0 {
+		fmt.Fprintf(r.w, "%v:\t%v\t\n", title, "none")
+		return
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		fmt.Fprintf(r.w, "%v:\tfailed to parse %d bytes: %v\t\n", title, len(der), err)
+		return
+	}
+	fingerprint := sha256.Sum256(der)
+	fmt.Fprintf(r.w, "%v:\t\t\n", title)
+	fmt.Fprintf(r.w, "  Subject:\t%v\t\n", cert.Subject)
+	fmt.Fprintf(r.w, "  Issuer:\t%v\t\n", cert.Issuer)
+	fmt.Fprintf(r.w, "  Subject Alternative Names:\t%v\t\n", orNone(strings.Join(subjectAltNames(cert), ", ")))
+	fmt.Fprintf(r.w, "  Serial Number:\t%v\t\n", colonHex(cert.SerialNumber.Bytes()))
+	fmt.Fprintf(r.w, "  Not Before:\t%v\t\n", prettyTimeValue(cert.NotBefore))
+	fmt.Fprintf(r.w, "  Not After:\t%v\t\n", prettyTimeValue(cert.NotAfter))
+	fmt.Fprintf(r.w, "  Key Type:\t%v\t\n", keyType(cert))
+	fmt.Fprintf(r.w, "  SHA-256 Fingerprint:\t%v\t\n", colonHex(fingerprint[:]))
+	if warning := expiryWarning(cert, time.Now()); warning != "" {
+		fmt.Fprintf(r.w, "  Warning:\t%v\t\n", warning)
+		fmt.Fprintf(os.Stderr, "Warning: the %v %v\n", strings.ToLower(title), warning)
+	}
+}
+
+// printPEM dumps the certificate in PEM form, if there is one
+func (r *commandRun) printPEM(der []byte) {
+	if len(der) == 0 {
+		return
+	}
+	pem.Encode(r.out, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
@@ -1,18 +1,23 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
-	"os"
 	"strconv"
+	"strings"
 	"text/tabwriter"
+	"time"
 
 	"grpcdebug/transport"
 
 	"github.com/dustin/go-humanize"
+	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 	timestamppb "github.com/golang/protobuf/ptypes/timestamp"
+	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
 	"github.com/spf13/cobra"
 	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
 )
@@ -21,8 +26,15 @@ var (
 	jsonOutputFlag bool
 )
 
-// The table formater
-var w = tabwriter.NewWriter(os.Stdout, 10, 0, 3, ' ', 0)
+// tableWriter aligns the tab separated cells written to it once flushed
+type tableWriter interface {
+	io.Writer
+	Flush() error
+}
+
+func newTableWriter(output io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(output, 10, 0, 3, ' ', 0)
+}
 
 func prettyTime(ts *timestamppb.Timestamp) string {
 	if timestampFlag {
@@ -32,6 +44,13 @@ func prettyTime(ts *timestamppb.Timestamp) string {
 	return humanize.Time(t)
 }
 
+func prettyTimeValue(t time.Time) string {
+	if timestampFlag {
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	return humanize.Time(t)
+}
+
 func prettySeverity(s zpb.ChannelTraceEvent_Severity) string {
 	return zpb.ChannelTraceEvent_Severity_name[int32(s)]
 }
@@ -40,41 +59,163 @@ func prettyConnectivityState(state zpb.ChannelConnectivityState_State) string {
 	return zpb.ChannelConnectivityState_State_name[int32(state)]
 }
 
+// prettyAddress renders every variant of a channelz address. It never fails:
+// addresses it cannot decode are described by their type instead.
 func prettyAddress(addr *zpb.Address) string {
-	if ipPort := addr.GetTcpipAddress(); ipPort != nil {
-		var ip net.IP = net.IP(ipPort.IpAddress)
-		return fmt.Sprintf("%v:%v", ip, ipPort.Port)
-	}
-	panic(fmt.Sprintf("Address type not supported for %s", addr))
-}
-
-func printChannelTraceEvents(events []*zpb.ChannelTraceEvent) {
-	fmt.Fprintln(w, "Severity\tTime\tChild Ref\tDescription\t")
-	for _, event := range events {
-		var childRef string
-		switch event.ChildRef.(type) {
-		case *zpb.ChannelTraceEvent_SubchannelRef:
-			childRef = fmt.Sprintf("subchannel(%v)", event.GetSubchannelRef())
-		case *zpb.ChannelTraceEvent_ChannelRef:
-			childRef = fmt.Sprintf("channel(%v)", event.GetChannelRef())
+	if addr == nil {
+		return "none"
+	}
+	switch x := addr.Address.(type) {
+	case *zpb.Address_TcpipAddress:
+		ipPort := x.TcpipAddress
+		host := ""
+		if len(ipPort.IpAddress) > 0 {
+			host = net.IP(ipPort.IpAddress).String()
+		}
+		// JoinHostPort brackets IPv6 addresses
+		return net.JoinHostPort(host, strconv.Itoa(int(ipPort.Port)))
+	case *zpb.Address_UdsAddress_:
+		// The peer of a Unix socket is usually unnamed
+		name := x.UdsAddress.Filename
+		if name == "" || name == "@" {
+			return "unix:(unnamed)"
+		}
+		// Abstract sockets are reported with a leading "@" or NUL byte
+		if strings.HasPrefix(name, "@") || strings.HasPrefix(name, "\x00") {
+			return "unix-abstract:" + name[1:]
+		}
+		return "unix:" + name
+	case *zpb.Address_OtherAddress_:
+		return prettyOtherAddress(x.OtherAddress)
+	default:
+		return "unknown"
+	}
+}
+
+// prettyOtherAddress renders an address of a transport channelz does not
+// model, like an in-process one, unpacking its payload when the type is known
+func prettyOtherAddress(other *zpb.Address_OtherAddress) string {
+	name := other.Name
+	if name == "" {
+		name = "other"
+	}
+	if other.Value == nil {
+		return name
+	}
+	var payload ptypes.DynamicAny
+	if err := ptypes.UnmarshalAny(other.Value, &payload); err != nil {
+		// The payload type is not linked in, so only its name is known
+		typeName, _ := ptypes.AnyMessageName(other.Value)
+		if typeName == "" {
+			typeName = other.Value.TypeUrl
 		}
+		return fmt.Sprintf("%v(%v)", name, typeName)
+	}
+	if nested, ok := payload.Message.(*zpb.Address); ok {
+		return fmt.Sprintf("%v(%v)", name, prettyAddress(nested))
+	}
+	return fmt.Sprintf("%v(%v)", name, strings.TrimSpace(proto.CompactTextString(payload.Message)))
+}
+
+// printChannelTraceEvents prints the events kept in the trace, noting how many
+// older ones were dropped
+func (r *commandRun) printChannelTraceEvents(trace *zpb.ChannelTrace) {
+	if dropped := trace.GetNumEventsLogged() - int64(len(trace.GetEvents())); dropped > 0 {
+		fmt.Fprintf(r.out, "%v older events were dropped\n", dropped)
+	}
+	fmt.Fprintln(r.w, "Severity\tTime\tChild Ref\tDescription\t")
+	for _, event := range trace.GetEvents() {
 		fmt.Fprintf(
-			w, "%v\t%v\t%v\t%v\t\n",
+			r.w, "%v\t%v\t%v\t%v\t\n",
 			prettySeverity(event.Severity),
 			prettyTime(event.Timestamp),
-			childRef,
+			childRefOf(event),
 			event.Description,
 		)
 	}
-	w.Flush()
+	r.w.Flush()
+}
+
+// prettyFlowControlWindow renders a window, which transports may not report
+func prettyFlowControlWindow(window *wrapperspb.Int64Value) string {
+	if window == nil {
+		return "unknown"
+	}
+	return fmt.Sprint(window.Value)
+}
+
+// socketEntry is a row of the socket table: either the fetched socket, or the
+// error encountered while fetching it. The side is only known, and shown, when
+// listing the sockets of both sides.
+type socketEntry struct {
+	id     int64
+	side   string
+	socket *zpb.Socket
+	err    error
+}
+
+// fetchSockets fetches every referenced socket, keeping failed ones as entries
+// so they can still be listed.
+func fetchSockets(ctx context.Context, f *transport.Fetcher, socketRefs []*zpb.SocketRef) ([]socketEntry, error) {
+	var entries []socketEntry
+	var errs fetchErrors
+	sockets, socketErrs := f.Sockets(ctx, socketRefs)
+	for i, socketRef := range socketRefs {
+		errs.add(socketErrs[i])
+		entries = append(entries, socketEntry{id: socketRef.SocketId, socket: sockets[i], err: socketErrs[i]})
+	}
+	return entries, errs.err()
 }
 
-func printSockets(sockets []*zpb.Socket) {
-	fmt.Fprintln(w, "Socket ID\tLocal->Remote\tStreams(Started/Succeeded/Failed)\tMessages(Sent/Received)\t")
-	for _, socket := range sockets {
+func hasSocketErrors(entries []socketEntry) bool {
+	for _, entry := range entries {
+		if entry.err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func hasSocketSides(entries []socketEntry) bool {
+	for _, entry := range entries {
+		if entry.side != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *commandRun) printSockets(entries []socketEntry) {
+	withErrors := hasSocketErrors(entries)
+	withSides := hasSocketSides(entries)
+	header := "Socket ID\t"
+	if withSides {
+		header += "Side\t"
+	}
+	header += "Local->Remote\tStreams(Started/Succeeded/Failed)\tMessages(Sent/Received)\t"
+	if r.watching != nil {
+		header += "Streams/s\tMessages/s\t"
+	}
+	if withErrors {
+		header += "Error\t"
+	}
+	fmt.Fprintln(r.w, header)
+	for _, entry := range entries {
+		fmt.Fprintf(r.w, "%v\t", entry.id)
+		if withSides {
+			fmt.Fprintf(r.w, "%v\t", entry.side)
+		}
+		if entry.err != nil {
+			fmt.Fprint(r.w, "-\t-\t-\t")
+			if r.watching != nil {
+				fmt.Fprint(r.w, "-\t-\t")
+			}
+			fmt.Fprintf(r.w, "%v\t\n", prettyError(entry.err))
+			continue
+		}
+		socket := entry.socket
 		fmt.Fprintf(
-			w, "%v\t%v\t%v/%v/%v\t%v/%v\t\n",
-			socket.Ref.SocketId,
+			r.w, "%v\t%v/%v/%v\t%v/%v\t",
 			fmt.Sprintf("%v->%v", prettyAddress(socket.Local), prettyAddress(socket.Remote)),
 			socket.Data.StreamsStarted,
 			socket.Data.StreamsSucceeded,
@@ -82,40 +223,66 @@ func printSockets(sockets []*zpb.Socket) {
 			socket.Data.MessagesSent,
 			socket.Data.MessagesReceived,
 		)
+		if r.watching != nil {
+			streamRates, messageRates := r.socketRates(socket)
+			fmt.Fprintf(r.w, "%v\t%v\t", streamRates, messageRates)
+		}
+		if withErrors {
+			fmt.Fprint(r.w, "\t")
+		}
+		fmt.Fprintln(r.w)
 	}
-	w.Flush()
+	r.w.Flush()
 }
 
-func printAsJson(data interface{}) error {
+func (r *commandRun) printAsJson(data interface{}) error {
 	json, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
 		return err
 	}
-	fmt.Println(string(json))
+	fmt.Fprintln(r.out, string(json))
 	return nil
 }
 
-func channelzChannelsCommandRunWithError(cmd *cobra.Command, args []string) error {
-	var channels = transport.Channels()
+func channelzChannelsCommandRunWithError(r *commandRun, cmd *cobra.Command, args []string) error {
+	return r.runWatched(cmd, func() error { return r.showChannels(cmd, args) })
+}
+
+func (r *commandRun) showChannels(cmd *cobra.Command, args []string) error {
+	channels, err := r.client.Channels(cmd.Context())
+	if err != nil {
+		return err
+	}
+	if channels, err = filterChannels(channels); err != nil {
+		return err
+	}
 	// Print as JSON
 	if jsonOutputFlag {
-		return printAsJson(channels)
+		return r.printAsJson(channels)
 	}
 	// Print as table
-	fmt.Fprintln(w, "Channel ID\tTarget\tState\tCalls(Started/Succeeded/Failed)\tCreated Time\t")
+	if r.watching != nil {
+		fmt.Fprintln(r.w, "Channel ID\tTarget\tState\tCalls(Started/Succeeded/Failed)\tCalls/s\tCreated Time\t")
+	} else {
+		fmt.Fprintln(r.w, "Channel ID\tTarget\tState\tCalls(Started/Succeeded/Failed)\tCreated Time\t")
+	}
 	for _, channel := range channels {
+		key := fmt.Sprintf("channel/%v", channel.Ref.ChannelId)
 		fmt.Fprintf(
-			w, "%v\t%v\t%v\t%v/%v/%v\t%v\t\n",
+			r.w, "%v\t%v\t%v\t%v/%v/%v\t",
 			channel.Ref.ChannelId,
 			channel.Data.Target,
-			prettyConnectivityState(channel.Data.State.State),
+			r.watchedState(key, prettyConnectivityState(channel.Data.State.State)),
 			channel.Data.CallsStarted,
 			channel.Data.CallsSucceeded,
 			channel.Data.CallsFailed,
-			prettyTime(channel.Data.Trace.CreationTimestamp),
 		)
+		if r.watching != nil {
+			fmt.Fprintf(r.w, "%v\t", r.callRates(key, channel.Data.CallsStarted, channel.Data.CallsSucceeded, channel.Data.CallsFailed))
+		}
+		fmt.Fprintf(r.w, "%v\t\n", prettyTime(channel.Data.Trace.CreationTimestamp))
 	}
-	w.Flush()
+	r.w.Flush()
 	return nil
 }
 
@@ -123,87 +290,143 @@ var channelzChannelsCmd = &cobra.Command{
 	Use:   "channels",
 	Short: "List client channels for the target application.",
 	Args:  cobra.NoArgs,
-	RunE:  channelzChannelsCommandRunWithError,
+	RunE:  withRun(channelzChannelsCommandRunWithError),
 }
 
-func channelzChannelCommandRunWithError(cmd *cobra.Command, args []string) error {
-	var idOrTarget string = args[0]
+// selectChannel finds a channel by ID or by target. Targets are only matched
+// against the top channels, while IDs can also name nested channels.
+func (r *commandRun) selectChannel(ctx context.Context, idOrTarget string) (*zpb.Channel, error) {
 	var selected *zpb.Channel
-	var channels []*zpb.Channel = transport.Channels()
+	channels, err := r.client.Channels(ctx)
+	if err != nil {
+		return nil, err
+	}
 	if id, err := strconv.ParseInt(idOrTarget, 10, 64); err == nil {
 		// Find by ID
 		for _, channel := range channels {
 			if channel.Ref.ChannelId == id {
-				selected = channel
-				break
+				return channel, nil
 			}
 		}
+		// Nested channels are not listed among the top channels
+		return r.client.Channel(ctx, id)
 	} else {
 		// Find by matching target
 		for _, channel := range channels {
 			if channel.Data.Target == idOrTarget {
 				if selected != nil {
-					return fmt.Errorf("More than one channel is connecting to target %v", idOrTarget)
+					return nil, fmt.Errorf("More than one channel is connecting to target %v", idOrTarget)
 				}
 				selected = channel
 			}
 		}
 	}
 	if selected == nil {
-		return fmt.Errorf("Cannot find channel with ID or target equal to %v", idOrTarget)
+		return nil, fmt.Errorf("Cannot find channel with ID or target equal to %v", idOrTarget)
+	}
+	return selected, nil
+}
+
+// printChildChannels prints the child channels or subchannels of a channel,
+// with an Error column if any of them failed to be fetched
+func (r *commandRun) printChildChannels(idHeader string, ids []int64, data []*zpb.ChannelData, errs []error) {
+	failed := false
+	for _, err := range errs {
+		failed = failed || err != nil
+	}
+	if failed {
+		fmt.Fprintf(r.w, "%v\tTarget\tState\tCalls(Started/Succeeded/Failed)\tCreatedTime\tError\t\n", idHeader)
+	} else {
+		fmt.Fprintf(r.w, "%v\tTarget\tState\tCalls(Started/Succeeded/Failed)\tCreatedTime\t\n", idHeader)
+	}
+	for i, id := range ids {
+		if errs[i] != nil {
+			fmt.Fprintf(r.w, "%v\t-\t-\t-\t-\t%v\t\n", id, prettyError(errs[i]))
+			continue
+		}
+		fmt.Fprintf(
+			r.w, "%v\t%v\t%v\t%v/%v/%v\t%v\t\n",
+			id,
+			data[i].Target,
+			prettyConnectivityState(data[i].State.State),
+			data[i].CallsStarted,
+			data[i].CallsSucceeded,
+			data[i].CallsFailed,
+			prettyTime(data[i].Trace.CreationTimestamp),
+		)
+	}
+	r.w.Flush()
+}
+
+func channelzChannelCommandRunWithError(r *commandRun, cmd *cobra.Command, args []string) error {
+	selected, err := r.selectChannel(cmd.Context(), args[0])
+	if err != nil {
+		return err
 	}
 	// Print as JSON
 	if jsonOutputFlag {
-		return printAsJson(selected)
+		return r.printAsJson(selected)
 	}
 	// Print as table
 	// Print Channel information
-	fmt.Fprintf(w, "Channel ID:\t%v\t\n", selected.Ref.ChannelId)
-	fmt.Fprintf(w, "Target:\t%v\t\n", selected.Data.Target)
-	fmt.Fprintf(w, "State:\t%v\t\n", prettyConnectivityState(selected.Data.State.State))
-	fmt.Fprintf(w, "Calls Started:\t%v\t\n", selected.Data.CallsStarted)
-	fmt.Fprintf(w, "Calls Succeeded:\t%v\t\n", selected.Data.CallsSucceeded)
-	fmt.Fprintf(w, "Calls Failed:\t%v\t\n", selected.Data.CallsFailed)
-	fmt.Fprintf(w, "Created Time:\t%v\t\n", prettyTime(selected.Data.Trace.CreationTimestamp))
-	w.Flush()
-	// Print Subchannel list
+	fmt.Fprintf(r.w, "Channel ID:\t%v\t\n", selected.Ref.ChannelId)
+	fmt.Fprintf(r.w, "Target:\t%v\t\n", selected.Data.Target)
+	fmt.Fprintf(r.w, "State:\t%v\t\n", prettyConnectivityState(selected.Data.State.State))
+	fmt.Fprintf(r.w, "Calls Started:\t%v\t\n", selected.Data.CallsStarted)
+	fmt.Fprintf(r.w, "Calls Succeeded:\t%v\t\n", selected.Data.CallsSucceeded)
+	fmt.Fprintf(r.w, "Calls Failed:\t%v\t\n", selected.Data.CallsFailed)
+	fmt.Fprintf(r.w, "Created Time:\t%v\t\n", prettyTime(selected.Data.Trace.CreationTimestamp))
+	r.w.Flush()
+	// Print the child channels, then the subchannels
+	var errs fetchErrors
+	f := r.client.NewFetcher()
+	if len(selected.ChannelRef) > 0 {
+		fmt.Fprintln(r.out, "---")
+		channels, channelErrs := f.Channels(cmd.Context(), selected.ChannelRef)
+		ids := make([]int64, len(channels))
+		data := make([]*zpb.ChannelData, len(channels))
+		for i, channelRef := range selected.ChannelRef {
+			ids[i], data[i] = channelRef.ChannelId, channels[i].GetData()
+			errs.add(channelErrs[i])
+		}
+		r.printChildChannels("Channel ID", ids, data, channelErrs)
+	}
 	if len(selected.SubchannelRef) > 0 {
-		fmt.Println("---")
-		fmt.Fprintln(w, "Subchannel ID\tTarget\tState\tCalls(Started/Succeeded/Failed)\tCreatedTime\t")
-		for _, subchannelRef := range selected.SubchannelRef {
-			var subchannel = transport.Subchannel(subchannelRef.SubchannelId)
-			fmt.Fprintf(
-				w, "%v\t%v\t%v\t%v/%v/%v\t%v\t\n",
-				subchannel.Ref.SubchannelId,
-				subchannel.Data.Target,
-				prettyConnectivityState(subchannel.Data.State.State),
-				subchannel.Data.CallsStarted,
-				subchannel.Data.CallsSucceeded,
-				subchannel.Data.CallsFailed,
-				prettyTime(subchannel.Data.Trace.CreationTimestamp),
-			)
+		fmt.Fprintln(r.out, "---")
+		subchannels, subchannelErrs := f.Subchannels(cmd.Context(), selected.SubchannelRef)
+		ids := make([]int64, len(subchannels))
+		data := make([]*zpb.ChannelData, len(subchannels))
+		for i, subchannelRef := range selected.SubchannelRef {
+			ids[i], data[i] = subchannelRef.SubchannelId, subchannels[i].GetData()
+			errs.add(subchannelErrs[i])
 		}
-		w.Flush()
+		r.printChildChannels("Subchannel ID", ids, data, subchannelErrs)
 	}
 	// Print channel trace events
 	if len(selected.Data.Trace.Events) != 0 {
-		fmt.Println("---")
-		printChannelTraceEvents(selected.Data.Trace.Events)
+		fmt.Fprintln(r.out, "---")
+		r.printChannelTraceEvents(selected.Data.Trace)
 	}
-	return nil
+	return errs.err()
 }
 
 var channelzChannelCmd = &cobra.Command{
 	Use:   "channel <channel id or URL>",
 	Short: "Display channel states in human readable way.",
 	Args:  cobra.ExactArgs(1),
-	RunE:  channelzChannelCommandRunWithError,
+	RunE:  withRun(channelzChannelCommandRunWithError),
+}
+
+func channelzSubchannelCommandRunWithError(r *commandRun, cmd *cobra.Command, args []string) error {
+	return r.runWatched(cmd, func() error { return r.showSubchannel(cmd, args) })
 }
 
-func channelzSubchannelCommandRunWithError(cmd *cobra.Command, args []string) error {
+func (r *commandRun) showSubchannel(cmd *cobra.Command, args []string) error {
 	var idOrTarget string = args[0]
 	var selected *zpb.Subchannel
-	var subchannels []*zpb.Subchannel = transport.Subchannels()
+	// Subchannels that failed to be fetched are only fatal if the requested one
+	// is among them
+	subchannels, fetchErr := r.client.Subchannels(cmd.Context())
 	if id, err := strconv.ParseInt(idOrTarget, 10, 64); err == nil {
 		for _, subchannel := range subchannels {
 			if subchannel.Ref.SubchannelId == id {
@@ -211,6 +434,14 @@ func channelzSubchannelCommandRunWithError(cmd *cobra.Command, args []string) er
 				break
 			}
 		}
+		// Subchannels of nested channels are not listed either
+		if selected == nil {
+			subchannel, err := r.client.Subchannel(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+			selected = subchannel
+		}
 	} else {
 		for _, subchannel := range subchannels {
 			if subchannel.Data.Target == idOrTarget {
@@ -222,30 +453,35 @@ func channelzSubchannelCommandRunWithError(cmd *cobra.Command, args []string) er
 		}
 	}
 	if selected == nil {
+		if fetchErr != nil {
+			return fetchErr
+		}
 		return fmt.Errorf("Cannot find subchannel with ID or target equal to %v", idOrTarget)
 	}
 	// Print as JSON
 	if jsonOutputFlag {
-		return printAsJson(selected)
+		return r.printAsJson(selected)
 	}
 	// Print as table
 	// Print Subchannel information
-	fmt.Fprintf(w, "Subchannel ID:\t%v\t\n", selected.Ref.SubchannelId)
-	fmt.Fprintf(w, "Target:\t%v\t\n", selected.Data.Target)
-	fmt.Fprintf(w, "State:\t%v\t\n", prettyConnectivityState(selected.Data.State.State))
-	fmt.Fprintf(w, "Calls Started:\t%v\t\n", selected.Data.CallsStarted)
-	fmt.Fprintf(w, "Calls Succeeded:\t%v\t\n", selected.Data.CallsSucceeded)
-	fmt.Fprintf(w, "Calls Failed:\t%v\t\n", selected.Data.CallsFailed)
-	fmt.Fprintf(w, "Created Time:\t%v\t\n", prettyTime(selected.Data.Trace.CreationTimestamp))
-	w.Flush()
+	key := fmt.Sprintf("subchannel/%v", selected.Ref.SubchannelId)
+	fmt.Fprintf(r.w, "Subchannel ID:\t%v\t\n", selected.Ref.SubchannelId)
+	fmt.Fprintf(r.w, "Target:\t%v\t\n", selected.Data.Target)
+	fmt.Fprintf(r.w, "State:\t%v\t\n", r.watchedState(key, prettyConnectivityState(selected.Data.State.State)))
+	fmt.Fprintf(r.w, "Calls Started:\t%v\t\n", selected.Data.CallsStarted)
+	fmt.Fprintf(r.w, "Calls Succeeded:\t%v\t\n", selected.Data.CallsSucceeded)
+	fmt.Fprintf(r.w, "Calls Failed:\t%v\t\n", selected.Data.CallsFailed)
+	if r.watching != nil {
+		fmt.Fprintf(r.w, "Calls/s (Started/Succeeded/Failed):\t%v\t\n", r.callRates(key, selected.Data.CallsStarted, selected.Data.CallsSucceeded, selected.Data.CallsFailed))
+	}
+	fmt.Fprintf(r.w, "Created Time:\t%v\t\n", prettyTime(selected.Data.Trace.CreationTimestamp))
+	r.w.Flush()
 	if len(selected.SocketRef) > 0 {
 		// Print socket list
-		fmt.Println("---")
-		var sockets []*zpb.Socket
-		for _, socketRef := range selected.SocketRef {
-			sockets = append(sockets, transport.Socket(socketRef.SocketId))
-		}
-		printSockets(sockets)
+		fmt.Fprintln(r.out, "---")
+		entries, err := fetchSockets(cmd.Context(), r.client.NewFetcher(), selected.SocketRef)
+		r.printSockets(entries)
+		return err
 	}
 	return nil
 }
@@ -254,76 +490,83 @@ var channelzSubchannelCmd = &cobra.Command{
 	Use:   "subchannel",
 	Short: "Display subchannel states in human readable way.",
 	Args:  cobra.ExactArgs(1),
-	RunE:  channelzSubchannelCommandRunWithError,
+	RunE:  withRun(channelzSubchannelCommandRunWithError),
+}
+
+func channelzSocketCommandRunWithError(r *commandRun, cmd *cobra.Command, args []string) error {
+	return r.runWatched(cmd, func() error { return r.showSocket(cmd, args) })
 }
 
-func channelzSocketCommandRunWithError(cmd *cobra.Command, args []string) error {
+func (r *commandRun) showSocket(cmd *cobra.Command, args []string) error {
 	socketId, err := strconv.ParseInt(args[0], 10, 64)
 	if err != nil {
-		return fmt.Errorf("Invalid socket ID %v", socketId)
+		return fmt.Errorf("Invalid socket ID %v", args[0])
+	}
+	selected, err := r.client.Socket(cmd.Context(), socketId)
+	if err != nil {
+		return err
 	}
-	selected := transport.Socket(socketId)
 	if selected == nil {
 		return fmt.Errorf("Cannot find socket with ID %v", socketId)
 	}
 	// Print as JSON
 	if jsonOutputFlag {
-		return printAsJson(selected)
+		return r.printAsJson(selected)
 	}
 	// Print as table
 	// Print Socket information
-	fmt.Fprintf(w, "Socket ID:\t%v\t\n", selected.Ref.SocketId)
-	fmt.Fprintf(w, "Address:\t%v\t\n", fmt.Sprintf("%v->%v", prettyAddress(selected.Local), prettyAddress(selected.Remote)))
-	fmt.Fprintf(w, "Streams Started:\t%v\t\n", selected.Data.StreamsStarted)
-	fmt.Fprintf(w, "Streams Succeeded:\t%v\t\n", selected.Data.StreamsSucceeded)
-	fmt.Fprintf(w, "Streams Failed:\t%v\t\n", selected.Data.StreamsFailed)
-	fmt.Fprintf(w, "Messages Sent:\t%v\t\n", selected.Data.MessagesSent)
-	fmt.Fprintf(w, "Messages Received:\t%v\t\n", selected.Data.MessagesReceived)
-	fmt.Fprintf(w, "Keep Alives Sent:\t%v\t\n", selected.Data.KeepAlivesSent)
-	fmt.Fprintf(w, "Last Local Stream Created:\t%v\t\n", prettyTime(selected.Data.LastLocalStreamCreatedTimestamp))
-	fmt.Fprintf(w, "Last Remote Stream Created:\t%v\t\n", prettyTime(selected.Data.LastRemoteStreamCreatedTimestamp))
-	fmt.Fprintf(w, "Last Message Sent Created:\t%v\t\n", prettyTime(selected.Data.LastMessageSentTimestamp))
-	fmt.Fprintf(w, "Last Message Received Created:\t%v\t\n", prettyTime(selected.Data.LastMessageReceivedTimestamp))
-	fmt.Fprintf(w, "Local Flow Control Window:\t%v\t\n", selected.Data.LocalFlowControlWindow.Value)
-	fmt.Fprintf(w, "Remote Flow Control Window:\t%v\t\n", selected.Data.RemoteFlowControlWindow.Value)
-	w.Flush()
+	fmt.Fprintf(r.w, "Socket ID:\t%v\t\n", selected.Ref.SocketId)
+	fmt.Fprintf(r.w, "Address:\t%v\t\n", fmt.Sprintf("%v->%v", prettyAddress(selected.Local), prettyAddress(selected.Remote)))
+	fmt.Fprintf(r.w, "Streams Started:\t%v\t\n", selected.Data.StreamsStarted)
+	fmt.Fprintf(r.w, "Streams Succeeded:\t%v\t\n", selected.Data.StreamsSucceeded)
+	fmt.Fprintf(r.w, "Streams Failed:\t%v\t\n", selected.Data.StreamsFailed)
+	fmt.Fprintf(r.w, "Messages Sent:\t%v\t\n", selected.Data.MessagesSent)
+	fmt.Fprintf(r.w, "Messages Received:\t%v\t\n", selected.Data.MessagesReceived)
+	if r.watching != nil {
+		streamRates, messageRates := r.socketRates(selected)
+		fmt.Fprintf(r.w, "Streams/s (Started/Succeeded/Failed):\t%v\t\n", streamRates)
+		fmt.Fprintf(r.w, "Messages/s (Sent/Received):\t%v\t\n", messageRates)
+	}
+	fmt.Fprintf(r.w, "Keep Alives Sent:\t%v\t\n", selected.Data.KeepAlivesSent)
+	fmt.Fprintf(r.w, "Last Local Stream Created:\t%v\t\n", prettyTime(selected.Data.LastLocalStreamCreatedTimestamp))
+	fmt.Fprintf(r.w, "Last Remote Stream Created:\t%v\t\n", prettyTime(selected.Data.LastRemoteStreamCreatedTimestamp))
+	fmt.Fprintf(r.w, "Last Message Sent Created:\t%v\t\n", prettyTime(selected.Data.LastMessageSentTimestamp))
+	fmt.Fprintf(r.w, "Last Message Received Created:\t%v\t\n", prettyTime(selected.Data.LastMessageReceivedTimestamp))
+	fmt.Fprintf(r.w, "Local Flow Control Window:\t%v\t\n", prettyFlowControlWindow(selected.Data.LocalFlowControlWindow))
+	fmt.Fprintf(r.w, "Remote Flow Control Window:\t%v\t\n", prettyFlowControlWindow(selected.Data.RemoteFlowControlWindow))
+	r.w.Flush()
 	if len(selected.Data.Option) > 0 {
-		fmt.Println("---")
-		fmt.Fprintln(w, "Socket Options Name\tValue\t")
-		for _, option := range selected.Data.Option {
-			if option.Value != "" {
-				// Prefer human readable value than the Any proto
-				fmt.Fprintf(w, "%v\t%v\t\n", option.Name, option.Value)
-			} else {
-				fmt.Fprintf(w, "%v\t%v\t\n", option.Name, option.Additional)
-			}
-		}
-		w.Flush()
+		fmt.Fprintln(r.out, "---")
+		r.printSocketOptions(selected.Data.Option)
 	}
 	// Print security information
 	if security := selected.GetSecurity(); security != nil {
-		fmt.Println("---")
+		fmt.Fprintln(r.out, "---")
 		switch x := security.Model.(type) {
 		case *zpb.Security_Tls_:
-			fmt.Fprintf(w, "Security Model:\t%v\t\n", "TLS")
+			fmt.Fprintf(r.w, "Security Model:\t%v\t\n", "TLS")
 			switch y := security.GetTls().CipherSuite.(type) {
 			case *zpb.Security_Tls_StandardName:
-				fmt.Fprintf(w, "Standard Name:\t%v\t\n", security.GetTls().GetStandardName())
+				fmt.Fprintf(r.w, "Standard Name:\t%v\t\n", security.GetTls().GetStandardName())
 			case *zpb.Security_Tls_OtherName:
-				fmt.Fprintf(w, "Other Name:\t%v\t\n", security.GetTls().GetOtherName())
+				fmt.Fprintf(r.w, "Other Name:\t%v\t\n", security.GetTls().GetOtherName())
 			default:
 				return fmt.Errorf("Unexpected Cipher suite name type %T", y)
 			}
-			// fmt.Fprintf(w, "Local Certificate:\t%v\t\n", security.GetTls().LocalCertificate)
-			// fmt.Fprintf(w, "Remote Certificate:\t%v\t\n", security.GetTls().RemoteCertificate)
+			r.printCertificate("Local Certificate", security.GetTls().LocalCertificate)
+			r.printCertificate("Remote Certificate", security.GetTls().RemoteCertificate)
 		case *zpb.Security_Other:
-			fmt.Fprintf(w, "Security Model:\t%v\t\n", "Other")
-			fmt.Fprintf(w, "Name:\t%v\t\n", security.GetOther().Name)
+			fmt.Fprintf(r.w, "Security Model:\t%v\t\n", "Other")
+			fmt.Fprintf(r.w, "Name:\t%v\t\n", security.GetOther().Name)
 			// fmt.Fprintf(w, "Value:\t%v\t\n", security.GetOther().Value)
 		default:
 			return fmt.Errorf("Unexpected security model type %T", x)
 		}
-		w.Flush()
+		r.w.Flush()
+		if tls := security.GetTls(); tls != nil && pemFlag {
+			r.printPEM(tls.LocalCertificate)
+			r.printPEM(tls.RemoteCertificate)
+		}
 	}
 	return nil
 }
@@ -332,50 +575,110 @@ var channelzSocketCmd = &cobra.Command{
 	Use:   "socket",
 	Short: "Display socket states in human readable way.",
 	Args:  cobra.ExactArgs(1),
-	RunE:  channelzSocketCommandRunWithError,
+	RunE:  withRun(channelzSocketCommandRunWithError),
 }
 
-func channelzServersCommandRunWithError(cmd *cobra.Command, args []string) error {
-	var servers = transport.Servers()
+// listenAddressesOf resolves the listen sockets of a server into addresses.
+// Sockets that cannot be fetched are shown by ID, and the first error is
+// returned.
+func listenAddressesOf(ctx context.Context, f *transport.Fetcher, server *zpb.Server) ([]string, error) {
+	var listenAddresses []string
+	var firstErr error
+	sockets, errs := f.Sockets(ctx, server.ListenSocket)
+	for i, socketRef := range server.ListenSocket {
+		socket, err := sockets[i], errs[i]
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			listenAddresses = append(listenAddresses, fmt.Sprintf("socket(%v)", socketRef.SocketId))
+			continue
+		}
+		listenAddresses = append(listenAddresses, prettyAddress(socket.Local))
+	}
+	return listenAddresses, firstErr
+}
+
+func channelzServersCommandRunWithError(r *commandRun, cmd *cobra.Command, args []string) error {
+	return r.runWatched(cmd, func() error { return r.showServers(cmd, args) })
+}
+
+func (r *commandRun) showServers(cmd *cobra.Command, args []string) error {
+	servers, err := r.client.Servers(cmd.Context())
+	if err != nil {
+		return err
+	}
+	if servers, err = filterServers(servers); err != nil {
+		return err
+	}
 	// Print as JSON
 	if jsonOutputFlag {
-		return printAsJson(servers)
+		return r.printAsJson(servers)
 	}
 	// Print as table
-	fmt.Fprintln(w, "Server ID\tListenAddresses\tCallsStarted\tCallsSucceeded\tCallsFailed\tCreated Time\t")
+	var errs fetchErrors
+	var listenAddresses = make([][]string, len(servers))
+	var serverErrs = make([]error, len(servers))
+	// Fetch the listen sockets of every server at once, then resolve each
+	// server from the cache
+	f := r.client.NewFetcher()
+	var listenSocketRefs []*zpb.SocketRef
 	for _, server := range servers {
-		var listenAddresses []string
-		for _, socketRef := range server.ListenSocket {
-			socket := transport.Socket(socketRef.SocketId)
-			listenAddresses = append(listenAddresses, prettyAddress(socket.Local))
-		}
+		listenSocketRefs = append(listenSocketRefs, server.ListenSocket...)
+	}
+	f.Sockets(cmd.Context(), listenSocketRefs)
+	for i, server := range servers {
+		listenAddresses[i], serverErrs[i] = listenAddressesOf(cmd.Context(), f, server)
+		errs.add(serverErrs[i])
+	}
+	header := "Server ID\tListenAddresses\tCallsStarted\tCallsSucceeded\tCallsFailed\t"
+	if r.watching != nil {
+		header += "Calls/s\t"
+	}
+	header += "Last Call Started\t"
+	if errs.failed > 0 {
+		header += "Error\t"
+	}
+	fmt.Fprintln(r.w, header)
+	for i, server := range servers {
 		fmt.Fprintf(
-			w, "%v\t%v\t%v\t%v\t%v\t%v\t\n",
+			r.w, "%v\t%v\t%v\t%v\t%v\t",
 			server.Ref.ServerId,
-			listenAddresses,
+			listenAddresses[i],
 			server.Data.CallsStarted,
 			server.Data.CallsSucceeded,
 			server.Data.CallsFailed,
-			prettyTime(server.Data.LastCallStartedTimestamp),
 		)
+		if r.watching != nil {
+			key := fmt.Sprintf("server/%v", server.Ref.ServerId)
+			fmt.Fprintf(r.w, "%v\t", r.callRates(key, server.Data.CallsStarted, server.Data.CallsSucceeded, server.Data.CallsFailed))
+		}
+		fmt.Fprintf(r.w, "%v\t", prettyTime(server.Data.LastCallStartedTimestamp))
+		if errs.failed > 0 {
+			fmt.Fprintf(r.w, "%v\t", prettyError(serverErrs[i]))
+		}
+		fmt.Fprintln(r.w)
 	}
-	w.Flush()
-	return nil
+	r.w.Flush()
+	return errs.err()
 }
 
 var channelzServersCmd = &cobra.Command{
 	Use:   "servers",
 	Short: "List servers in human readable way.",
 	Args:  cobra.NoArgs,
-	RunE:  channelzServersCommandRunWithError,
+	RunE:  withRun(channelzServersCommandRunWithError),
 }
 
-func channelzServerCommandRunWithError(cmd *cobra.Command, args []string) error {
-	var servers = transport.Servers()
+func channelzServerCommandRunWithError(r *commandRun, cmd *cobra.Command, args []string) error {
+	servers, err := r.client.Servers(cmd.Context())
+	if err != nil {
+		return err
+	}
 	var selected *zpb.Server
 	serverId, err := strconv.ParseInt(args[0], 10, 64)
 	if err != nil {
-		return fmt.Errorf("Invalid server ID %v", serverId)
+		return fmt.Errorf("Invalid server ID %v", args[0])
 	}
 	for _, server := range servers {
 		if server.Ref.ServerId == serverId {
@@ -388,34 +691,42 @@ func channelzServerCommandRunWithError(cmd *cobra.Command, args []string) error
 	}
 	// Print as JSON
 	if jsonOutputFlag {
-		return printAsJson(servers)
+		return r.printAsJson(selected)
 	}
 	// Print as table
-	var listenAddresses []string
-	for _, socketRef := range selected.ListenSocket {
-		socket := transport.Socket(socketRef.SocketId)
-		listenAddresses = append(listenAddresses, prettyAddress(socket.Local))
+	var errs fetchErrors
+	f := r.client.NewFetcher()
+	listenAddresses, err := listenAddressesOf(cmd.Context(), f, selected)
+	errs.add(err)
+	fmt.Fprintf(r.w, "Server Id:\t%v\t\n", selected.Ref.ServerId)
+	fmt.Fprintf(r.w, "Listen Addresses:\t%v\t\n", listenAddresses)
+	fmt.Fprintf(r.w, "Calls Started:\t%v\t\n", selected.Data.CallsStarted)
+	fmt.Fprintf(r.w, "Calls Succeeded:\t%v\t\n", selected.Data.CallsSucceeded)
+	fmt.Fprintf(r.w, "Calls Failed:\t%v\t\n", selected.Data.CallsFailed)
+	fmt.Fprintf(r.w, "Last Call Started:\t%v\t\n", prettyTime(selected.Data.LastCallStartedTimestamp))
+	r.w.Flush()
+	socketRefs, err := f.ServerSocketRefs(cmd.Context(), selected.Ref.ServerId)
+	if err != nil {
+		errs.add(err)
+		return errs.err()
 	}
-	fmt.Fprintf(w, "Server Id:\t%v\t\n", selected.Ref.ServerId)
-	fmt.Fprintf(w, "Listen Addresses:\t%v\t\n", listenAddresses)
-	fmt.Fprintf(w, "Calls Started:\t%v\t\n", selected.Data.CallsStarted)
-	fmt.Fprintf(w, "Calls Succeeded:\t%v\t\n", selected.Data.CallsSucceeded)
-	fmt.Fprintf(w, "Calls Failed:\t%v\t\n", selected.Data.CallsFailed)
-	fmt.Fprintf(w, "Created Time:\t%v\t\n", prettyTime(selected.Data.LastCallStartedTimestamp))
-	w.Flush()
-	if sockets := transport.ServerSocket(selected.Ref.ServerId); len(sockets) > 0 {
+	if len(socketRefs) > 0 {
 		// Print socket list
-		fmt.Println("---")
-		printSockets(sockets)
+		fmt.Fprintln(r.out, "---")
+		entries, _ := fetchSockets(cmd.Context(), f, socketRefs)
+		for _, entry := range entries {
+			errs.add(entry.err)
+		}
+		r.printSockets(entries)
 	}
-	return nil
+	return errs.err()
 }
 
 var channelzServerCmd = &cobra.Command{
 	Use:   "server <id>",
 	Short: "Display server state in human readable way.",
 	Args:  cobra.ExactArgs(1),
-	RunE:  channelzServerCommandRunWithError,
+	RunE:  withRun(channelzServerCommandRunWithError),
 }
 
 var channelzCmd = &cobra.Command{
@@ -426,9 +737,14 @@ var channelzCmd = &cobra.Command{
 
 func init() {
 	channelzCmd.PersistentFlags().BoolVarP(&jsonOutputFlag, "json", "o", false, "Whether to print the result as JSON")
+	for _, cmd := range []*cobra.Command{channelzChannelsCmd, channelzServersCmd, channelzSubchannelCmd, channelzSocketCmd} {
+		addWatchFlag(cmd)
+	}
 	channelzCmd.AddCommand(channelzChannelCmd)
 	channelzCmd.AddCommand(channelzChannelsCmd)
 	channelzCmd.AddCommand(channelzSubchannelCmd)
+	channelzSocketCmd.Flags().DurationVar(&certExpiryWarningFlag, "cert_expiry_warning", 30*24*time.Hour, "Warns about certificates expiring within this duration; 0 only warns about expired ones")
+	channelzSocketCmd.Flags().BoolVar(&pemFlag, "pem", false, "Dumps the local and remote certificates in PEM form")
 	channelzCmd.AddCommand(channelzSocketCmd)
 	channelzCmd.AddCommand(channelzServersCmd)
 	channelzCmd.AddCommand(channelzServerCmd)
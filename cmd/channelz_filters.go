@@ -0,0 +1,200 @@
+// Defines the filters and the ordering of the channelz list commands
+
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"grpcdebug/transport"
+
+	"github.com/spf13/cobra"
+	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+)
+
+var (
+	stateFilterFlag  string
+	targetFilterFlag string
+	minFailedFlag    int64
+	sinceFlag        time.Duration
+	sortByFlag       string
+	topFlag          int
+)
+
+// The orders accepted by --sort_by. Counters sort in decreasing order, and
+// creation times from the newest.
+var sortOrders = []string{"calls", "failures", "failure_ratio", "created"}
+
+// listEntry holds what the filters and the ordering look at, for a channel
+// or a server
+type listEntry struct {
+	state    zpb.ChannelConnectivityState_State
+	target   string
+	started  int64
+	failed   int64
+	created  time.Time
+	lastCall time.Time
+}
+
+// failureRatio is the share of started calls that failed, or 0 without calls
+func (e listEntry) failureRatio() float64 {
+	if e.started == 0 {
+		return 0
+	}
+	return float64(e.failed) / float64(e.started)
+}
+
+// parseStates parses a comma separated list of connectivity states, in any case
+func parseStates(value string) (map[zpb.ChannelConnectivityState_State]bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+	states := make(map[zpb.ChannelConnectivityState_State]bool)
+	for _, name := range strings.Split(value, ",") {
+		state, ok := zpb.ChannelConnectivityState_State_value[strings.ToUpper(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("Unknown state %q, expected one of IDLE, CONNECTING, READY, TRANSIENT_FAILURE, SHUTDOWN", name)
+		}
+		states[zpb.ChannelConnectivityState_State(state)] = true
+	}
+	return states, nil
+}
+
+// parseTargetFilter returns a matcher for --target: a regular expression
+// between slashes, a pattern with * and ? wildcards, or else a substring
+func parseTargetFilter(value string) (func(string) bool, error) {
+	switch {
+	case value == "":
+		return func(string) bool { return true }, nil
+	case len(value) > 1 && strings.HasPrefix(value, "/") && strings.HasSuffix(value, "/"):
+		re, err := regexp.Compile(value[1 : len(value)-1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid --target regular expression: %v", err)
+		}
+		return re.MatchString, nil
+	case strings.ContainsAny(value, "*?"):
+		return func(target string) bool { return transport.MatchPattern(value, target) }, nil
+	default:
+		return func(target string) bool { return strings.Contains(target, value) }, nil
+	}
+}
+
+// selectEntries applies the filter and ordering flags, and returns the
+// indexes of the selected entries in the order to print them
+func selectEntries(entries []listEntry) ([]int, error) {
+	states, err := parseStates(stateFilterFlag)
+	if err != nil {
+		return nil, err
+	}
+	matchTarget, err := parseTargetFilter(targetFilterFlag)
+	if err != nil {
+		return nil, err
+	}
+	if topFlag < 0 {
+		return nil, fmt.Errorf("--top must not be negative")
+	}
+	var selected []int
+	now := time.Now()
+	for i, entry := range entries {
+		if states != nil && !states[entry.state] {
+			continue
+		}
+		if !matchTarget(entry.target) || entry.failed < minFailedFlag {
+			continue
+		}
+		if sinceFlag > 0 && entry.lastCall.Before(now.Add(-sinceFlag)) {
+			continue
+		}
+		selected = append(selected, i)
+	}
+	var less func(a, b listEntry) bool
+	switch sortByFlag {
+	case "":
+	case "calls":
+		less = func(a, b listEntry) bool { return a.started > b.started }
+	case "failures":
+		less = func(a, b listEntry) bool { return a.failed > b.failed }
+	case "failure_ratio":
+		less = func(a, b listEntry) bool { return a.failureRatio() > b.failureRatio() }
+	case "created":
+		less = func(a, b listEntry) bool { return a.created.After(b.created) }
+	default:
+		return nil, fmt.Errorf("Unknown --sort_by %q, expected one of %v", sortByFlag, strings.Join(sortOrders, ", "))
+	}
+	if less != nil {
+		sort.SliceStable(selected, func(i, j int) bool {
+			return less(entries[selected[i]], entries[selected[j]])
+		})
+	}
+	if topFlag > 0 && len(selected) > topFlag {
+		selected = selected[:topFlag]
+	}
+	return selected, nil
+}
+
+// filterChannels applies the filter and ordering flags to the channels
+func filterChannels(channels []*zpb.Channel) ([]*zpb.Channel, error) {
+	entries := make([]listEntry, len(channels))
+	for i, channel := range channels {
+		data := channel.GetData()
+		entries[i] = listEntry{
+			state:    data.GetState().GetState(),
+			target:   data.GetTarget(),
+			started:  data.GetCallsStarted(),
+			failed:   data.GetCallsFailed(),
+			created:  transport.TimeOf(data.GetTrace().GetCreationTimestamp()),
+			lastCall: transport.TimeOf(data.GetLastCallStartedTimestamp()),
+		}
+	}
+	selected, err := selectEntries(entries)
+	if err != nil {
+		return nil, err
+	}
+	filtered := make([]*zpb.Channel, len(selected))
+	for i, index := range selected {
+		filtered[i] = channels[index]
+	}
+	return filtered, nil
+}
+
+// filterServers applies the filter and ordering flags to the servers
+func filterServers(servers []*zpb.Server) ([]*zpb.Server, error) {
+	entries := make([]listEntry, len(servers))
+	for i, server := range servers {
+		data := server.GetData()
+		entries[i] = listEntry{
+			started:  data.GetCallsStarted(),
+			failed:   data.GetCallsFailed(),
+			created:  transport.TimeOf(data.GetTrace().GetCreationTimestamp()),
+			lastCall: transport.TimeOf(data.GetLastCallStartedTimestamp()),
+		}
+	}
+	selected, err := selectEntries(entries)
+	if err != nil {
+		return nil, err
+	}
+	filtered := make([]*zpb.Server, len(selected))
+	for i, index := range selected {
+		filtered[i] = servers[index]
+	}
+	return filtered, nil
+}
+
+// addListFlags registers the filters and ordering flags shared by the list
+// commands
+func addListFlags(cmd *cobra.Command) {
+	cmd.Flags().Int64Var(&minFailedFlag, "min_failed", 0, "Only lists entries with at least this many failed calls")
+	cmd.Flags().DurationVar(&sinceFlag, "since", 0, "Only lists entries that started a call within this duration")
+	cmd.Flags().StringVar(&sortByFlag, "sort_by", "", "Sorts by one of "+strings.Join(sortOrders, ", ")+", largest or newest first")
+	cmd.Flags().IntVar(&topFlag, "top", 0, "Only lists the first N entries, after sorting")
+}
+
+func init() {
+	addListFlags(channelzChannelsCmd)
+	addListFlags(channelzServersCmd)
+	channelzChannelsCmd.Flags().StringVar(&stateFilterFlag, "state", "", "Only lists channels in one of these comma separated states, like TRANSIENT_FAILURE,CONNECTING")
+	channelzChannelsCmd.Flags().StringVar(&targetFilterFlag, "target", "", "Only lists channels whose target contains this string, matches this pattern with * and ? wildcards, or matches this /regular expression/")
+}
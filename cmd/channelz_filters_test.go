@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+)
+
+func TestSelectEntries(t *testing.T) {
+	now := time.Now()
+	entries := []listEntry{
+		{state: zpb.ChannelConnectivityState_READY, target: "dns:///backend:443", started: 100, failed: 1, created: now.Add(-3 * time.Hour), lastCall: now.Add(-time.Minute)},
+		{state: zpb.ChannelConnectivityState_TRANSIENT_FAILURE, target: "xds:///backend", started: 10, failed: 5, created: now.Add(-time.Hour), lastCall: now.Add(-2 * time.Hour)},
+		{state: zpb.ChannelConnectivityState_CONNECTING, target: "control-plane:443", started: 50, failed: 10, created: now.Add(-2 * time.Hour)},
+		{state: zpb.ChannelConnectivityState_READY, target: "localhost:50051", created: now},
+	}
+	for _, test := range []struct {
+		name      string
+		state     string
+		target    string
+		minFailed int64
+		since     time.Duration
+		sortBy    string
+		top       int
+		want      []int
+		wantErr   bool
+	}{
+		{name: "no filter", want: []int{0, 1, 2, 3}},
+		{name: "state", state: "ready", want: []int{0, 3}},
+		{name: "several states", state: "TRANSIENT_FAILURE, connecting", want: []int{1, 2}},
+		{name: "unknown state", state: "BROKEN", wantErr: true},
+		{name: "target substring", target: "backend", want: []int{0, 1}},
+		{name: "target pattern", target: "*:443", want: []int{0, 2}},
+		{name: "target regular expression", target: "/^(dns|xds):/", want: []int{0, 1}},
+		{name: "bad regular expression", target: "/(/", wantErr: true},
+		{name: "min failed", minFailed: 5, want: []int{1, 2}},
+		// Entries that never started a call are not recent
+		{name: "since", since: time.Hour, want: []int{0}},
+		{name: "sort by calls", sortBy: "calls", want: []int{0, 2, 1, 3}},
+		{name: "sort by failures", sortBy: "failures", want: []int{2, 1, 0, 3}},
+		{name: "sort by failure ratio", sortBy: "failure_ratio", want: []int{1, 2, 0, 3}},
+		{name: "sort by creation", sortBy: "created", want: []int{3, 1, 2, 0}},
+		{name: "unknown order", sortBy: "name", wantErr: true},
+		{name: "top after sorting", sortBy: "failures", top: 2, want: []int{2, 1}},
+		{name: "top larger than the list", top: 10, want: []int{0, 1, 2, 3}},
+		{name: "negative top", top: -1, wantErr: true},
+		{name: "combined", state: "READY,CONNECTING", target: "443", sortBy: "failures", want: []int{2, 0}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			stateFilterFlag, targetFilterFlag, minFailedFlag, sinceFlag, sortByFlag, topFlag = test.state, test.target, test.minFailed, test.since, test.sortBy, test.top
+			defer func() {
+				stateFilterFlag, targetFilterFlag, minFailedFlag, sinceFlag, sortByFlag, topFlag = "", "", 0, 0, "", 0
+			}()
+			got, err := selectEntries(entries)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("selectEntries() error = %v, want an error: %v", err, test.wantErr)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("selectEntries() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"grpcdebug/transport"
+
+	"github.com/spf13/cobra"
+	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+)
+
+var (
+	socketSideFlag          string
+	socketLocalFlag         string
+	socketRemoteFlag        string
+	socketSecurityModelFlag string
+	socketActiveFlag        bool
+)
+
+// securityModel names how a socket is secured: "tls", "other" or "none"
+func securityModel(socket *zpb.Socket) string {
+	switch {
+	case socket.GetSecurity().GetTls() != nil:
+		return "tls"
+	case socket.GetSecurity().GetOther() != nil:
+		return "other"
+	default:
+		return "none"
+	}
+}
+
+// matchAddress matches a pretty address against a pattern with * and ?
+// wildcards, or, without wildcards, checks that it contains the pattern
+func matchAddress(pattern string, addr *zpb.Address) bool {
+	if pattern == "" {
+		return true
+	}
+	if addr == nil {
+		return false
+	}
+	pretty := prettyAddress(addr)
+	if strings.ContainsAny(pattern, "*?") {
+		return transport.MatchPattern(pattern, pretty)
+	}
+	return strings.Contains(pretty, pattern)
+}
+
+// activeStreams counts the streams started but not finished yet
+func activeStreams(socket *zpb.Socket) int64 {
+	data := socket.GetData()
+	return data.GetStreamsStarted() - data.GetStreamsSucceeded() - data.GetStreamsFailed()
+}
+
+// matchSocket reports whether the entry passes the filters. Entries that
+// failed to be fetched only pass when no filter needs their content.
+func matchSocket(entry transport.SocketEntry) bool {
+	if socketSideFlag != "" && entry.Side.String() != socketSideFlag {
+		return false
+	}
+	if entry.Err != nil {
+		return socketLocalFlag == "" && socketRemoteFlag == "" && socketSecurityModelFlag == "" && !socketActiveFlag
+	}
+	socket := entry.Socket
+	if !matchAddress(socketLocalFlag, socket.Local) || !matchAddress(socketRemoteFlag, socket.Remote) {
+		return false
+	}
+	if socketSecurityModelFlag != "" && securityModel(socket) != socketSecurityModelFlag {
+		return false
+	}
+	if socketActiveFlag && activeStreams(socket) <= 0 {
+		return false
+	}
+	return true
+}
+
+// socketJSON is a socket of the --json output, along with its side, or the
+// error fetching it
+type socketJSON struct {
+	Side   transport.SocketSide
+	ID     int64
+	Socket *zpb.Socket `json:",omitempty"`
+	Error  string      `json:",omitempty"`
+}
+
+func channelzSocketsCommandRunWithError(r *commandRun, cmd *cobra.Command, args []string) error {
+	switch socketSideFlag {
+	case "", "client", "server":
+	default:
+		return fmt.Errorf("Unknown side %q, expecting client or server", socketSideFlag)
+	}
+	switch socketSecurityModelFlag {
+	case "", "tls", "other", "none":
+	default:
+		return fmt.Errorf("Unknown security model %q, expecting tls, other or none", socketSecurityModelFlag)
+	}
+	all, err := r.client.NewFetcher().AllSockets(cmd.Context())
+	var errs fetchErrors
+	errs.add(err)
+	var entries []socketEntry
+	var jsonEntries []socketJSON
+	for _, entry := range all {
+		if !matchSocket(entry) {
+			continue
+		}
+		errs.add(entry.Err)
+		entries = append(entries, socketEntry{id: entry.ID, side: entry.Side.String(), socket: entry.Socket, err: entry.Err})
+		jsonEntry := socketJSON{Side: entry.Side, ID: entry.ID, Socket: entry.Socket}
+		if entry.Err != nil {
+			jsonEntry.Error = prettyError(entry.Err)
+		}
+		jsonEntries = append(jsonEntries, jsonEntry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].id < entries[j].id })
+	sort.Slice(jsonEntries, func(i, j int) bool { return jsonEntries[i].ID < jsonEntries[j].ID })
+	// Print as JSON
+	if jsonOutputFlag {
+		if err := r.printAsJson(jsonEntries); err != nil {
+			return err
+		}
+		return errs.err()
+	}
+	// Print as table
+	if len(entries) > 0 {
+		r.printSockets(entries)
+	}
+	return errs.err()
+}
+
+var channelzSocketsCmd = &cobra.Command{
+	Use:   "sockets",
+	Short: "List the sockets of all subchannels and servers.",
+	Args:  cobra.NoArgs,
+	RunE:  withRun(channelzSocketsCommandRunWithError),
+}
+
+func init() {
+	channelzSocketsCmd.Flags().StringVar(&socketSideFlag, "side", "", "Only lists the sockets of this side [client, server]")
+	channelzSocketsCmd.Flags().StringVar(&socketLocalFlag, "local", "", "Only lists the sockets whose local address contains this, or matches it if it has * or ? wildcards")
+	channelzSocketsCmd.Flags().StringVar(&socketRemoteFlag, "remote", "", "Only lists the sockets whose remote address contains this, or matches it if it has * or ? wildcards")
+	channelzSocketsCmd.Flags().StringVar(&socketSecurityModelFlag, "security_model", "", "Only lists the sockets secured this way [tls, other, none]")
+	channelzSocketsCmd.Flags().BoolVar(&socketActiveFlag, "active", false, "Only lists the sockets with active streams")
+	channelzCmd.AddCommand(channelzSocketsCmd)
+}
@@ -0,0 +1,228 @@
+// Defines the channelz summary command, a health report across every channel,
+// subchannel, server and socket
+
+package cmd
+
+import (
+	"fmt"
+
+	"grpcdebug/transport"
+
+	"github.com/spf13/cobra"
+	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+)
+
+var maxFailureRatioFlag float64
+
+// callTotals sums the calls of a group of channels or servers
+type callTotals struct {
+	Started      int64
+	Succeeded    int64
+	Failed       int64
+	SuccessRatio float64
+}
+
+func (t *callTotals) add(started, succeeded, failed int64) {
+	t.Started += started
+	t.Succeeded += succeeded
+	t.Failed += failed
+	// Calls in flight are neither succeeded nor failed
+	if finished := t.Succeeded + t.Failed; finished > 0 {
+		t.SuccessRatio = float64(t.Succeeded) / float64(finished)
+	}
+}
+
+// prettySuccessRatio renders the success ratio, which is meaningless until a
+// call finished
+func (t *callTotals) prettySuccessRatio() string {
+	if t.Succeeded+t.Failed == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%.1f%%", t.SuccessRatio*100)
+}
+
+// healthCheck is one check of the summary, with the entities failing it
+type healthCheck struct {
+	Name     string
+	Findings []string
+}
+
+// summary is the health report of the target
+type summary struct {
+	Channels callTotals
+	Servers  callTotals
+	Checks   []*healthCheck
+}
+
+func (s *summary) check(name string) *healthCheck {
+	check := &healthCheck{Name: name}
+	s.Checks = append(s.Checks, check)
+	return check
+}
+
+func (c *healthCheck) add(format string, args ...interface{}) {
+	c.Findings = append(c.Findings, fmt.Sprintf(format, args...))
+}
+
+// failureRatio is the share of finished calls that failed
+func failureRatio(succeeded, failed int64) float64 {
+	if succeeded+failed == 0 {
+		return 0
+	}
+	return float64(failed) / float64(succeeded+failed)
+}
+
+// checkFlowControl records a socket whose local or remote flow control window
+// is exhausted. Windows the application does not report are not checked.
+func checkFlowControl(check *healthCheck, side transport.SocketSide, socket *zpb.Socket) {
+	data := socket.GetData()
+	local, remote := data.GetLocalFlowControlWindow(), data.GetRemoteFlowControlWindow()
+	if (local != nil && local.Value <= 0) || (remote != nil && remote.Value <= 0) {
+		check.add(
+			"%v socket %v %v->%v: window %v/%v",
+			side,
+			socket.GetRef().GetSocketId(),
+			prettyAddress(socket.Local),
+			prettyAddress(socket.Remote),
+			local.GetValue(),
+			remote.GetValue(),
+		)
+	}
+}
+
+func channelzSummaryCommandRunWithError(r *commandRun, cmd *cobra.Command, args []string) error {
+	if maxFailureRatioFlag < 0 || maxFailureRatioFlag > 1 {
+		return fmt.Errorf("--max_failure_ratio must be between 0 and 1")
+	}
+	ctx := cmd.Context()
+	var errs fetchErrors
+	var s summary
+	stuck := s.check("Channels in TRANSIENT_FAILURE or CONNECTING")
+	noSockets := s.check("Subchannels without sockets")
+	failing := s.check(fmt.Sprintf("Servers failing more than %.1f%% of calls", maxFailureRatioFlag*100))
+	exhausted := s.check("Sockets with a zero flow control window")
+	// Walk every channel, with the subchannels and sockets nested under it
+	channels, err := r.client.Channels(ctx)
+	if err != nil {
+		return err
+	}
+	f := r.client.NewFetcher()
+	seen := make(map[string]bool)
+	var walk func(node *transport.TreeNode)
+	walk = func(node *transport.TreeNode) {
+		key := fmt.Sprintf("%v/%v", node.Kind, node.ID)
+		if seen[key] || node.Cycle {
+			return
+		}
+		seen[key] = true
+		if node.Err != nil {
+			errs.add(node.Err)
+			return
+		}
+		switch node.Kind {
+		case transport.ChannelNode:
+			data := node.Channel.GetData()
+			switch state := data.GetState().GetState(); state {
+			case zpb.ChannelConnectivityState_TRANSIENT_FAILURE, zpb.ChannelConnectivityState_CONNECTING:
+				stuck.add("Channel %v%v is %v", node.ID, targetSuffix(data.GetTarget()), prettyConnectivityState(state))
+			}
+		case transport.SubchannelNode:
+			// Idle and shut down subchannels are not expected to be connected
+			switch state := node.Subchannel.GetData().GetState().GetState(); state {
+			case zpb.ChannelConnectivityState_IDLE, zpb.ChannelConnectivityState_SHUTDOWN:
+			default:
+				if len(node.Subchannel.GetSocketRef()) == 0 {
+					noSockets.add("Subchannel %v%v has no sockets while %v", node.ID, targetSuffix(node.Subchannel.GetData().GetTarget()), prettyConnectivityState(state))
+				}
+			}
+		case transport.SocketNode:
+			checkFlowControl(exhausted, transport.ClientSide, node.Socket)
+		}
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	for _, channel := range channels {
+		data := channel.GetData()
+		s.Channels.add(data.GetCallsStarted(), data.GetCallsSucceeded(), data.GetCallsFailed())
+		tree, _ := f.ChannelTree(ctx, channel)
+		walk(tree)
+	}
+	// Walk every server, with its connected sockets
+	servers, err := r.client.Servers(ctx)
+	if err != nil {
+		return err
+	}
+	serverSocketRefs, refErrs := f.ServersSocketRefs(ctx, servers)
+	for i, server := range servers {
+		data := server.GetData()
+		s.Servers.add(data.GetCallsStarted(), data.GetCallsSucceeded(), data.GetCallsFailed())
+		if ratio := failureRatio(data.GetCallsSucceeded(), data.GetCallsFailed()); ratio > maxFailureRatioFlag {
+			failing.add("Server %v failed %.1f%% of %v calls", server.GetRef().GetServerId(), ratio*100, data.GetCallsSucceeded()+data.GetCallsFailed())
+		}
+		errs.add(refErrs[i])
+		sockets, socketErrs := f.Sockets(ctx, serverSocketRefs[i])
+		for j, socket := range sockets {
+			errs.add(socketErrs[j])
+			if socketErrs[j] == nil {
+				checkFlowControl(exhausted, transport.ServerSide, socket)
+			}
+		}
+	}
+	breached := 0
+	for _, check := range s.Checks {
+		if len(check.Findings) > 0 {
+			breached++
+		}
+	}
+	// Print as JSON
+	if jsonOutputFlag {
+		if err := r.printAsJson(s); err != nil {
+			return err
+		}
+	} else {
+		// Print as table
+		fmt.Fprintln(r.w, "Calls\tStarted\tSucceeded\tFailed\tSuccess Ratio\t")
+		for _, row := range []struct {
+			name   string
+			totals callTotals
+		}{{"Channels", s.Channels}, {"Servers", s.Servers}} {
+			fmt.Fprintf(r.w, "%v\t%v\t%v\t%v\t%v\t\n", row.name, row.totals.Started, row.totals.Succeeded, row.totals.Failed, row.totals.prettySuccessRatio())
+		}
+		r.w.Flush()
+		fmt.Fprintln(r.out, "---")
+		fmt.Fprintln(r.w, "Check\tFound\tStatus\t")
+		for _, check := range s.Checks {
+			status := "OK"
+			if len(check.Findings) > 0 {
+				status = "FAIL"
+			}
+			fmt.Fprintf(r.w, "%v\t%v\t%v\t\n", check.Name, len(check.Findings), status)
+		}
+		r.w.Flush()
+		if breached > 0 {
+			fmt.Fprintln(r.out, "---")
+			for _, check := range s.Checks {
+				for _, finding := range check.Findings {
+					fmt.Fprintln(r.out, finding)
+				}
+			}
+		}
+	}
+	if breached > 0 {
+		return &unhealthyError{breached: breached}
+	}
+	return errs.err()
+}
+
+var channelzSummaryCmd = &cobra.Command{
+	Use:   "summary",
+	Short: "Check the health of every channel, subchannel, server and socket, exiting with code 3 if any check fails.",
+	Args:  cobra.NoArgs,
+	RunE:  withRun(channelzSummaryCommandRunWithError),
+}
+
+func init() {
+	channelzSummaryCmd.Flags().Float64Var(&maxFailureRatioFlag, "max_failure_ratio", 0.05, "Reports servers failing more than this share of their finished calls, between 0 and 1")
+	channelzCmd.AddCommand(channelzSummaryCmd)
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+)
+
+func TestChannelzSummary(t *testing.T) {
+	server := func(succeeded, failed int64) *zpb.Server {
+		return &zpb.Server{
+			Ref:  &zpb.ServerRef{ServerId: 2},
+			Data: &zpb.ServerData{CallsStarted: succeeded + failed, CallsSucceeded: succeeded, CallsFailed: failed},
+		}
+	}
+	for _, test := range []struct {
+		name            string
+		state           zpb.ChannelConnectivityState_State
+		server          *zpb.Server
+		maxFailureRatio float64
+		want            []string
+		wantExitCode    int
+	}{
+		{
+			name:            "healthy",
+			state:           zpb.ChannelConnectivityState_READY,
+			server:          server(96, 4),
+			maxFailureRatio: 0.05,
+			want:            []string{"n/a", "96.0%"},
+		},
+		{
+			name:            "at the threshold",
+			state:           zpb.ChannelConnectivityState_READY,
+			server:          server(95, 5),
+			maxFailureRatio: 0.05,
+			want:            []string{"95.0%"},
+		},
+		{
+			name:            "above the threshold",
+			state:           zpb.ChannelConnectivityState_READY,
+			server:          server(94, 6),
+			maxFailureRatio: 0.05,
+			want:            []string{"Server 2 failed 6.0% of 100 calls"},
+			wantExitCode:    exitCodeUnhealthy,
+		},
+		{
+			name:            "any failure",
+			state:           zpb.ChannelConnectivityState_IDLE,
+			server:          server(1000, 1),
+			maxFailureRatio: 0,
+			want:            []string{"Server 2 failed 0.1% of 1001 calls"},
+			wantExitCode:    exitCodeUnhealthy,
+		},
+		{
+			name:            "stuck channel",
+			state:           zpb.ChannelConnectivityState_TRANSIENT_FAILURE,
+			server:          server(0, 0),
+			maxFailureRatio: 0.05,
+			want:            []string{"Channel 1 xds:///service is TRANSIENT_FAILURE"},
+			wantExitCode:    exitCodeUnhealthy,
+		},
+		{
+			name:            "invalid ratio",
+			server:          server(0, 0),
+			maxFailureRatio: 1.5,
+			wantExitCode:    exitCodeFailure,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			stub := &stubChannelz{
+				channels: map[int64]*zpb.Channel{
+					1: {Ref: &zpb.ChannelRef{ChannelId: 1}, Data: channelData("xds:///service", test.state)},
+				},
+				servers: []*zpb.Server{test.server},
+			}
+			var buf bytes.Buffer
+			saved := maxFailureRatioFlag
+			defer func() { maxFailureRatioFlag = saved }()
+			maxFailureRatioFlag = test.maxFailureRatio
+			err := runAgainst(stub, channelzSummaryCommandRunWithError, &buf)
+			if err == nil && test.wantExitCode != 0 || err != nil && exitCode(err) != test.wantExitCode {
+				t.Errorf("summary = %v, want exit code %v", err, test.wantExitCode)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("output lacks %q:\n%v", want, buf.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"grpcdebug/transport"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// stubChannelz serves fixed channels, subchannels and servers without sockets
+type stubChannelz struct {
+	zpb.ChannelzClient
+	channels    map[int64]*zpb.Channel
+	subchannels map[int64]*zpb.Subchannel
+	servers     []*zpb.Server
+}
+
+func (s *stubChannelz) GetTopChannels(ctx context.Context, in *zpb.GetTopChannelsRequest, opts ...grpc.CallOption) (*zpb.GetTopChannelsResponse, error) {
+	return &zpb.GetTopChannelsResponse{Channel: []*zpb.Channel{s.channels[1]}, End: true}, nil
+}
+
+func (s *stubChannelz) GetChannel(ctx context.Context, in *zpb.GetChannelRequest, opts ...grpc.CallOption) (*zpb.GetChannelResponse, error) {
+	channel, ok := s.channels[in.ChannelId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no channel %v", in.ChannelId)
+	}
+	return &zpb.GetChannelResponse{Channel: channel}, nil
+}
+
+func (s *stubChannelz) GetSubchannel(ctx context.Context, in *zpb.GetSubchannelRequest, opts ...grpc.CallOption) (*zpb.GetSubchannelResponse, error) {
+	subchannel, ok := s.subchannels[in.SubchannelId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no subchannel %v", in.SubchannelId)
+	}
+	return &zpb.GetSubchannelResponse{Subchannel: subchannel}, nil
+}
+
+func (s *stubChannelz) GetServers(ctx context.Context, in *zpb.GetServersRequest, opts ...grpc.CallOption) (*zpb.GetServersResponse, error) {
+	return &zpb.GetServersResponse{Server: s.servers, End: true}, nil
+}
+
+func (s *stubChannelz) GetServerSockets(ctx context.Context, in *zpb.GetServerSocketsRequest, opts ...grpc.CallOption) (*zpb.GetServerSocketsResponse, error) {
+	return &zpb.GetServerSocketsResponse{End: true}, nil
+}
+
+// runAgainst runs the body of a command against the stub, printing to buf
+func runAgainst(stub zpb.ChannelzClient, run runFunc, buf *bytes.Buffer, args ...string) error {
+	cmd := &cobra.Command{
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return run(newCommandRun(transport.NewClientFromStubs(stub, nil, nil), buf), cmd, args)
+		},
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+	cmd.SetArgs(append([]string{}, args...))
+	return cmd.ExecuteContext(context.Background())
+}
+
+func channelData(target string, state zpb.ChannelConnectivityState_State) *zpb.ChannelData {
+	return &zpb.ChannelData{
+		Target: target,
+		State:  &zpb.ChannelConnectivityState{State: state},
+		Trace:  &zpb.ChannelTrace{},
+	}
+}
+
+func TestChannelzChannelChildren(t *testing.T) {
+	stub := &stubChannelz{
+		channels: map[int64]*zpb.Channel{
+			1: {
+				Ref:           &zpb.ChannelRef{ChannelId: 1},
+				Data:          channelData("xds:///service", zpb.ChannelConnectivityState_READY),
+				ChannelRef:    []*zpb.ChannelRef{{ChannelId: 2}, {ChannelId: 9}},
+				SubchannelRef: []*zpb.SubchannelRef{{SubchannelId: 3}},
+			},
+			2: {
+				Ref:  &zpb.ChannelRef{ChannelId: 2},
+				Data: channelData("control-plane:443", zpb.ChannelConnectivityState_READY),
+			},
+		},
+		subchannels: map[int64]*zpb.Subchannel{
+			3: {
+				Ref:  &zpb.SubchannelRef{SubchannelId: 3},
+				Data: channelData("10.0.0.1:8080", zpb.ChannelConnectivityState_CONNECTING),
+			},
+		},
+	}
+	var buf bytes.Buffer
+	err := runAgainst(stub, channelzChannelCommandRunWithError, &buf, "1")
+	if exitCode(err) != exitCodePartial {
+		t.Errorf("channel = %v, want a partial failure for the missing child channel", err)
+	}
+	output := buf.String()
+	for _, want := range []string{
+		"Channel ID", "control-plane:443",
+		"9", "NotFound: no channel 9",
+		"Subchannel ID", "10.0.0.1:8080", "CONNECTING",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output lacks %q:\n%v", want, output)
+		}
+	}
+	// Only the table with a failure has an Error column
+	if strings.Count(output, "Error") != 1 {
+		t.Errorf("output has %v Error columns, want 1:\n%v", strings.Count(output, "Error"), output)
+	}
+}
+
+func TestChannelzNestedEntities(t *testing.T) {
+	stub := &stubChannelz{
+		channels: map[int64]*zpb.Channel{
+			1: {
+				Ref:        &zpb.ChannelRef{ChannelId: 1},
+				Data:       channelData("xds:///service", zpb.ChannelConnectivityState_READY),
+				ChannelRef: []*zpb.ChannelRef{{ChannelId: 2}},
+			},
+			2: {
+				Ref:           &zpb.ChannelRef{ChannelId: 2},
+				Data:          channelData("control-plane:443", zpb.ChannelConnectivityState_READY),
+				SubchannelRef: []*zpb.SubchannelRef{{SubchannelId: 3}},
+			},
+		},
+		subchannels: map[int64]*zpb.Subchannel{
+			3: {
+				Ref:  &zpb.SubchannelRef{SubchannelId: 3},
+				Data: channelData("10.0.0.2:443", zpb.ChannelConnectivityState_IDLE),
+			},
+		},
+	}
+	for _, test := range []struct {
+		name    string
+		run     runFunc
+		id      string
+		want    string
+		wantErr string
+	}{
+		{name: "nested channel", run: channelzChannelCommandRunWithError, id: "2", want: "control-plane:443"},
+		{name: "missing channel", run: channelzChannelCommandRunWithError, id: "7", wantErr: "no channel 7"},
+		{name: "subchannel of a nested channel", run: channelzSubchannelCommandRunWithError, id: "3", want: "10.0.0.2:443"},
+		{name: "missing subchannel", run: channelzSubchannelCommandRunWithError, id: "7", wantErr: "no subchannel 7"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := runAgainst(stub, test.run, &buf, test.id)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(buf.String(), test.want) {
+				t.Errorf("output lacks %q:\n%v", test.want, buf.String())
+			}
+		})
+	}
+}
+
+func TestPrettyAddress(t *testing.T) {
+	nested, err := ptypes.MarshalAny(&zpb.Address{Address: &zpb.Address_TcpipAddress{TcpipAddress: &zpb.Address_TcpIpAddress{IpAddress: []byte{10, 0, 0, 1}, Port: 80}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipv6 := make([]byte, 16)
+	ipv6[15] = 1
+	uds := func(name string) *zpb.Address {
+		return &zpb.Address{Address: &zpb.Address_UdsAddress_{UdsAddress: &zpb.Address_UdsAddress{Filename: name}}}
+	}
+	other := func(name string, value *any.Any) *zpb.Address {
+		return &zpb.Address{Address: &zpb.Address_OtherAddress_{OtherAddress: &zpb.Address_OtherAddress{Name: name, Value: value}}}
+	}
+	for _, test := range []struct {
+		name string
+		addr *zpb.Address
+		want string
+	}{
+		{name: "nil", addr: nil, want: "none"},
+		{name: "unset", addr: &zpb.Address{}, want: "unknown"},
+		{name: "ipv4", addr: &zpb.Address{Address: &zpb.Address_TcpipAddress{TcpipAddress: &zpb.Address_TcpIpAddress{IpAddress: []byte{127, 0, 0, 1}, Port: 50051}}}, want: "127.0.0.1:50051"},
+		{name: "ipv6", addr: &zpb.Address{Address: &zpb.Address_TcpipAddress{TcpipAddress: &zpb.Address_TcpIpAddress{IpAddress: ipv6, Port: 443}}}, want: "[::1]:443"},
+		{name: "no ip", addr: &zpb.Address{Address: &zpb.Address_TcpipAddress{TcpipAddress: &zpb.Address_TcpIpAddress{Port: 443}}}, want: ":443"},
+		{name: "uds", addr: uds("/tmp/admin.sock"), want: "unix:/tmp/admin.sock"},
+		{name: "unnamed uds", addr: uds(""), want: "unix:(unnamed)"},
+		{name: "abstract uds", addr: uds("@admin"), want: "unix-abstract:admin"},
+		{name: "abstract uds with a nul byte", addr: uds("\x00admin"), want: "unix-abstract:admin"},
+		{name: "other", addr: other("inprocess", nil), want: "inprocess"},
+		{name: "unnamed other", addr: other("", nil), want: "other"},
+		{name: "other with a nested address", addr: other("tunnel", nested), want: "tunnel(10.0.0.1:80)"},
+		{name: "other with an unknown payload", addr: other("custom", &any.Any{TypeUrl: "type.googleapis.com/custom.Address"}), want: "custom(custom.Address)"},
+	} {
+		if got := prettyAddress(test.addr); got != test.want {
+			t.Errorf("%v: prettyAddress() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+// Defines the channelz trace command, which filters, groups and merges the
+// trace events of channels and subchannels
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"grpcdebug/transport"
+
+	"github.com/spf13/cobra"
+	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+)
+
+var (
+	traceSeverityFlag string
+	traceSinceFlag    string
+	traceUntilFlag    string
+	traceGroupFlag    bool
+	traceMergeFlag    bool
+)
+
+// traceSource is a channel or subchannel whose trace is shown
+type traceSource struct {
+	Kind   transport.NodeKind
+	ID     int64
+	Logged int64
+	Kept   int
+	// The events logged but no longer kept by the application
+	Dropped int64
+	trace   *zpb.ChannelTrace
+}
+
+func (s *traceSource) name() string {
+	return fmt.Sprintf("%v %v", s.Kind, s.ID)
+}
+
+// timelineEvent is a trace event along with the entity that logged it. When
+// grouping, it stands for Count events with the same description.
+type timelineEvent struct {
+	Source      string
+	Severity    string
+	Time        time.Time
+	LastTime    time.Time `json:",omitempty"`
+	Count       int       `json:",omitempty"`
+	Description string
+	ChildRef    string `json:",omitempty"`
+}
+
+// parseSeverity parses a severity name like "warning" or "CT_WARNING"
+func parseSeverity(value string) (zpb.ChannelTraceEvent_Severity, error) {
+	name := strings.ToUpper(value)
+	if !strings.HasPrefix(name, "CT_") {
+		name = "CT_" + name
+	}
+	severity, ok := zpb.ChannelTraceEvent_Severity_value[name]
+	if !ok || severity == int32(zpb.ChannelTraceEvent_CT_UNKNOWN) {
+		return 0, fmt.Errorf("Unknown severity %q, expected one of info, warning, error", value)
+	}
+	return zpb.ChannelTraceEvent_Severity(severity), nil
+}
+
+// parseTimeBound parses a time as a duration before now, or as RFC 3339
+func parseTimeBound(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid time %q, expected a duration like 10m or an RFC 3339 time", value)
+	}
+	return t, nil
+}
+
+func childRefOf(event *zpb.ChannelTraceEvent) string {
+	switch event.ChildRef.(type) {
+	case *zpb.ChannelTraceEvent_SubchannelRef:
+		return fmt.Sprintf("subchannel(%v)", event.GetSubchannelRef())
+	case *zpb.ChannelTraceEvent_ChannelRef:
+		return fmt.Sprintf("channel(%v)", event.GetChannelRef())
+	}
+	return ""
+}
+
+func newTraceSource(kind transport.NodeKind, id int64, trace *zpb.ChannelTrace) *traceSource {
+	source := &traceSource{Kind: kind, ID: id, Logged: trace.GetNumEventsLogged(), Kept: len(trace.GetEvents()), trace: trace}
+	if source.Logged > int64(source.Kept) {
+		source.Dropped = source.Logged - int64(source.Kept)
+	}
+	return source
+}
+
+// collectTraceSources returns the traces of the entity and, when merging, of
+// every channel and subchannel nested under it. Each entity is visited once.
+func collectTraceSources(ctx context.Context, f *transport.Fetcher, root *traceSource, channelRefs []*zpb.ChannelRef, subchannelRefs []*zpb.SubchannelRef) ([]*traceSource, error) {
+	var errs fetchErrors
+	sources := []*traceSource{root}
+	visited := map[string]bool{root.name(): true}
+	for len(channelRefs) > 0 || len(subchannelRefs) > 0 {
+		var nextChannelRefs []*zpb.ChannelRef
+		var nextSubchannelRefs []*zpb.SubchannelRef
+		channels, channelErrs := f.Channels(ctx, channelRefs)
+		for i, channel := range channels {
+			errs.add(channelErrs[i])
+			if channelErrs[i] != nil {
+				continue
+			}
+			source := newTraceSource(transport.ChannelNode, channel.GetRef().GetChannelId(), channel.GetData().GetTrace())
+			if visited[source.name()] {
+				continue
+			}
+			visited[source.name()] = true
+			sources = append(sources, source)
+			nextChannelRefs = append(nextChannelRefs, channel.GetChannelRef()...)
+			nextSubchannelRefs = append(nextSubchannelRefs, channel.GetSubchannelRef()...)
+		}
+		subchannels, subchannelErrs := f.Subchannels(ctx, subchannelRefs)
+		for i, subchannel := range subchannels {
+			errs.add(subchannelErrs[i])
+			if subchannelErrs[i] != nil {
+				continue
+			}
+			source := newTraceSource(transport.SubchannelNode, subchannel.GetRef().GetSubchannelId(), subchannel.GetData().GetTrace())
+			if visited[source.name()] {
+				continue
+			}
+			visited[source.name()] = true
+			sources = append(sources, source)
+			nextChannelRefs = append(nextChannelRefs, subchannel.GetChannelRef()...)
+			nextSubchannelRefs = append(nextSubchannelRefs, subchannel.GetSubchannelRef()...)
+		}
+		channelRefs, subchannelRefs = nextChannelRefs, nextSubchannelRefs
+	}
+	return sources, errs.err()
+}
+
+// selectTraceSources finds the channel or subchannel by ID, or the channel by
+// target, along with its descendants when merging
+func (r *commandRun) selectTraceSources(ctx context.Context, idOrTarget string) ([]*traceSource, error) {
+	f := r.client.NewFetcher()
+	var channel *zpb.Channel
+	if id, err := strconv.ParseInt(idOrTarget, 10, 64); err == nil {
+		// Channels and subchannels share the ID space
+		var channelErr error
+		if channel, channelErr = f.Channel(ctx, id); channelErr != nil {
+			subchannel, err := f.Subchannel(ctx, id)
+			if err != nil {
+				return nil, fmt.Errorf("Cannot find channel or subchannel with ID %v: %v", id, prettyError(channelErr))
+			}
+			root := newTraceSource(transport.SubchannelNode, id, subchannel.GetData().GetTrace())
+			if !traceMergeFlag {
+				return []*traceSource{root}, nil
+			}
+			return collectTraceSources(ctx, f, root, subchannel.GetChannelRef(), subchannel.GetSubchannelRef())
+		}
+	} else if channel, err = r.selectChannel(ctx, idOrTarget); err != nil {
+		return nil, err
+	}
+	root := newTraceSource(transport.ChannelNode, channel.GetRef().GetChannelId(), channel.GetData().GetTrace())
+	if !traceMergeFlag {
+		return []*traceSource{root}, nil
+	}
+	return collectTraceSources(ctx, f, root, channel.GetChannelRef(), channel.GetSubchannelRef())
+}
+
+// timeline merges the events of the sources that pass the filters, oldest
+// first. Events logged at the same time keep the order of their sources.
+func timeline(sources []*traceSource, minSeverity zpb.ChannelTraceEvent_Severity, since, until time.Time) []timelineEvent {
+	var events []timelineEvent
+	for _, source := range sources {
+		for _, event := range source.trace.GetEvents() {
+			if event.Severity < minSeverity {
+				continue
+			}
+			t := transport.TimeOf(event.Timestamp)
+			if (!since.IsZero() && t.Before(since)) || (!until.IsZero() && t.After(until)) {
+				continue
+			}
+			events = append(events, timelineEvent{
+				Source:      source.name(),
+				Severity:    prettySeverity(event.Severity),
+				Time:        t,
+				Description: event.Description,
+				ChildRef:    childRefOf(event),
+			})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events
+}
+
+// groupEvents merges the events of a source with the same severity and
+// description, keeping the time of the first and the last one
+func groupEvents(events []timelineEvent) []timelineEvent {
+	var groups []timelineEvent
+	index := make(map[[3]string]int)
+	for _, event := range events {
+		key := [3]string{event.Source, event.Severity, event.Description}
+		if i, ok := index[key]; ok {
+			groups[i].Count++
+			groups[i].LastTime = event.Time
+			continue
+		}
+		index[key] = len(groups)
+		event.Count, event.LastTime = 1, event.Time
+		// Child refs differ between the grouped events
+		event.ChildRef = ""
+		groups = append(groups, event)
+	}
+	return groups
+}
+
+func channelzTraceCommandRunWithError(r *commandRun, cmd *cobra.Command, args []string) error {
+	var minSeverity zpb.ChannelTraceEvent_Severity
+	if traceSeverityFlag != "" {
+		severity, err := parseSeverity(traceSeverityFlag)
+		if err != nil {
+			return err
+		}
+		minSeverity = severity
+	}
+	now := time.Now()
+	since, err := parseTimeBound(traceSinceFlag, now)
+	if err != nil {
+		return err
+	}
+	until, err := parseTimeBound(traceUntilFlag, now)
+	if err != nil {
+		return err
+	}
+	sources, err := r.selectTraceSources(cmd.Context(), args[0])
+	if len(sources) == 0 {
+		return err
+	}
+	events := timeline(sources, minSeverity, since, until)
+	if traceGroupFlag {
+		events = groupEvents(events)
+	}
+	// Print as JSON
+	if jsonOutputFlag {
+		if jsonErr := r.printAsJson(struct {
+			Sources []*traceSource
+			Events  []timelineEvent
+		}{sources, events}); jsonErr != nil {
+			return jsonErr
+		}
+		return err
+	}
+	// Print as table
+	for _, source := range sources {
+		fmt.Fprintf(r.w, "%v:\t%v events kept\t", source.name(), source.Kept)
+		if source.Dropped > 0 {
+			fmt.Fprintf(r.w, "%v older events dropped\t", source.Dropped)
+		}
+		fmt.Fprintln(r.w)
+	}
+	r.w.Flush()
+	fmt.Fprintln(r.out, "---")
+	header := "Time\t"
+	if traceMergeFlag {
+		header += "Source\t"
+	}
+	header += "Severity\t"
+	if traceGroupFlag {
+		header += "Count\tLast Time\t"
+	} else {
+		header += "Child Ref\t"
+	}
+	fmt.Fprintln(r.w, header+"Description\t")
+	for _, event := range events {
+		fmt.Fprintf(r.w, "%v\t", prettyTimeValue(event.Time))
+		if traceMergeFlag {
+			fmt.Fprintf(r.w, "%v\t", event.Source)
+		}
+		fmt.Fprintf(r.w, "%v\t", event.Severity)
+		if traceGroupFlag {
+			fmt.Fprintf(r.w, "%v\t%v\t", event.Count, prettyTimeValue(event.LastTime))
+		} else {
+			fmt.Fprintf(r.w, "%v\t", event.ChildRef)
+		}
+		fmt.Fprintf(r.w, "%v\t\n", event.Description)
+	}
+	r.w.Flush()
+	return err
+}
+
+var channelzTraceCmd = &cobra.Command{
+	Use:   "trace <channel or subchannel id, or channel URL>",
+	Short: "Display the trace events of a channel or subchannel.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  withRun(channelzTraceCommandRunWithError),
+}
+
+func init() {
+	channelzTraceCmd.Flags().StringVar(&traceSeverityFlag, "severity", "", "Only shows events at least this severe: info, warning or error")
+	channelzTraceCmd.Flags().StringVar(&traceSinceFlag, "since", "", "Only shows events after this time, given as a duration before now like 10m, or in RFC 3339")
+	channelzTraceCmd.Flags().StringVar(&traceUntilFlag, "until", "", "Only shows events before this time, given like --since")
+	channelzTraceCmd.Flags().BoolVar(&traceGroupFlag, "group", false, "Groups the events of an entity with the same severity and description")
+	channelzTraceCmd.Flags().BoolVar(&traceMergeFlag, "merge", false, "Merges the events of every nested channel and subchannel into one timeline")
+	channelzCmd.AddCommand(channelzTraceCmd)
+}
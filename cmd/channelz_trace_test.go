@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"grpcdebug/transport"
+
+	"github.com/golang/protobuf/ptypes"
+	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+)
+
+// describe renders events as "source severity description" lines, with the
+// count of grouped ones
+func describe(events []timelineEvent) string {
+	var lines []string
+	for _, event := range events {
+		line := fmt.Sprintf("%v %v %v", event.Source, event.Severity, event.Description)
+		if event.Count > 0 {
+			line += fmt.Sprintf(" x%v", event.Count)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestTimeline(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := func(minutes int, severity zpb.ChannelTraceEvent_Severity, description string) *zpb.ChannelTraceEvent {
+		timestamp, err := ptypes.TimestampProto(start.Add(time.Duration(minutes) * time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &zpb.ChannelTraceEvent{Timestamp: timestamp, Severity: severity, Description: description}
+	}
+	sources := []*traceSource{
+		newTraceSource(transport.ChannelNode, 1, &zpb.ChannelTrace{Events: []*zpb.ChannelTraceEvent{
+			event(0, zpb.ChannelTraceEvent_CT_INFO, "created"),
+			event(2, zpb.ChannelTraceEvent_CT_WARNING, "resolver failed"),
+		}}),
+		newTraceSource(transport.SubchannelNode, 2, &zpb.ChannelTrace{Events: []*zpb.ChannelTraceEvent{
+			event(1, zpb.ChannelTraceEvent_CT_INFO, "connecting"),
+			event(2, zpb.ChannelTraceEvent_CT_ERROR, "connection refused"),
+		}}),
+	}
+	for _, test := range []struct {
+		name        string
+		minSeverity zpb.ChannelTraceEvent_Severity
+		since       time.Time
+		until       time.Time
+		want        []string
+	}{
+		{
+			// Events at the same time keep the order of their sources
+			name: "oldest first",
+			want: []string{"Channel 1 CT_INFO created", "Subchannel 2 CT_INFO connecting", "Channel 1 CT_WARNING resolver failed", "Subchannel 2 CT_ERROR connection refused"},
+		},
+		{
+			name:        "minimum severity",
+			minSeverity: zpb.ChannelTraceEvent_CT_WARNING,
+			want:        []string{"Channel 1 CT_WARNING resolver failed", "Subchannel 2 CT_ERROR connection refused"},
+		},
+		{
+			name:  "bounds are inclusive",
+			since: start.Add(time.Minute),
+			until: start.Add(time.Minute),
+			want:  []string{"Subchannel 2 CT_INFO connecting"},
+		},
+		{
+			name:  "nothing in range",
+			since: start.Add(time.Hour),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := describe(timeline(sources, test.minSeverity, test.since, test.until))
+			if want := strings.Join(test.want, "\n"); got != want {
+				t.Errorf("timeline() =\n%v\nwant\n%v", got, want)
+			}
+		})
+	}
+}
+
+func TestGroupEvents(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := func(source string, minutes int, severity, description string) timelineEvent {
+		return timelineEvent{Source: source, Severity: severity, Time: start.Add(time.Duration(minutes) * time.Minute), Description: description, ChildRef: "subchannel(3)"}
+	}
+	groups := groupEvents([]timelineEvent{
+		event("Channel 1", 0, "CT_INFO", "picker updated"),
+		event("Subchannel 2", 1, "CT_INFO", "picker updated"),
+		event("Channel 1", 2, "CT_WARNING", "picker updated"),
+		event("Channel 1", 3, "CT_INFO", "picker updated"),
+		event("Subchannel 2", 4, "CT_INFO", "picker updated"),
+		event("Channel 1", 5, "CT_INFO", "picker updated"),
+	})
+	// Groups are ordered by their first event, and split by source and severity
+	want := "Channel 1 CT_INFO picker updated x3\nSubchannel 2 CT_INFO picker updated x2\nChannel 1 CT_WARNING picker updated x1"
+	if got := describe(groups); got != want {
+		t.Errorf("groupEvents() =\n%v\nwant\n%v", got, want)
+	}
+	first := groups[0]
+	if !first.Time.Equal(start) || !first.LastTime.Equal(start.Add(5*time.Minute)) || first.ChildRef != "" {
+		t.Errorf("groupEvents()[0] = %+v, want the first and last times without a child ref", first)
+	}
+	if len(groupEvents(nil)) != 0 {
+		t.Errorf("groupEvents(nil) is not empty")
+	}
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"grpcdebug/transport"
+
+	"github.com/spf13/cobra"
+	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+)
+
+// describeNode renders one line of the tree, without the indentation
+func describeNode(node *transport.TreeNode) string {
+	if node.Err != nil {
+		return fmt.Sprintf("%v %v: %v", node.Kind, node.ID, prettyError(node.Err))
+	}
+	var description string
+	switch node.Kind {
+	case transport.ChannelNode:
+		data := node.Channel.GetData()
+		description = fmt.Sprintf(
+			"Channel %v%v [%v] calls %v/%v/%v",
+			node.ID,
+			targetSuffix(data.GetTarget()),
+			prettyConnectivityState(data.GetState().GetState()),
+			data.GetCallsStarted(),
+			data.GetCallsSucceeded(),
+			data.GetCallsFailed(),
+		)
+	case transport.SubchannelNode:
+		data := node.Subchannel.GetData()
+		description = fmt.Sprintf(
+			"Subchannel %v%v [%v] calls %v/%v/%v",
+			node.ID,
+			targetSuffix(data.GetTarget()),
+			prettyConnectivityState(data.GetState().GetState()),
+			data.GetCallsStarted(),
+			data.GetCallsSucceeded(),
+			data.GetCallsFailed(),
+		)
+	case transport.SocketNode:
+		socket := node.Socket
+		description = fmt.Sprintf(
+			"Socket %v %v->%v streams %v/%v/%v",
+			node.ID,
+			prettyAddress(socket.Local),
+			prettyAddress(socket.Remote),
+			socket.GetData().GetStreamsStarted(),
+			socket.GetData().GetStreamsSucceeded(),
+			socket.GetData().GetStreamsFailed(),
+		)
+	}
+	if node.Cycle {
+		description += " (cycle, already shown above)"
+	}
+	return description
+}
+
+// targetSuffix renders the target after the ID, if there is one
+func targetSuffix(target string) string {
+	if target == "" {
+		return ""
+	}
+	return " " + target
+}
+
+func (r *commandRun) printTree(node *transport.TreeNode, depth int) {
+	fmt.Fprintf(r.out, "%v%v\n", strings.Repeat("  ", depth), describeNode(node))
+	for _, child := range node.Children {
+		r.printTree(child, depth+1)
+	}
+}
+
+func channelzTreeCommandRunWithError(r *commandRun, cmd *cobra.Command, args []string) error {
+	var roots []*zpb.Channel
+	if len(args) == 1 {
+		selected, err := r.selectChannel(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+		roots = append(roots, selected)
+	} else {
+		var err error
+		if roots, err = r.client.Channels(cmd.Context()); err != nil {
+			return err
+		}
+	}
+	// One fetcher for all the roots, so shared entities are fetched once
+	f := r.client.NewFetcher()
+	var errs fetchErrors
+	var trees []*transport.TreeNode
+	for _, root := range roots {
+		tree, err := f.ChannelTree(cmd.Context(), root)
+		errs.add(err)
+		trees = append(trees, tree)
+	}
+	// Print as JSON
+	if jsonOutputFlag {
+		if err := r.printAsJson(trees); err != nil {
+			return err
+		}
+		return errs.err()
+	}
+	// Print as tree
+	for _, tree := range trees {
+		r.printTree(tree, 0)
+	}
+	return errs.err()
+}
+
+var channelzTreeCmd = &cobra.Command{
+	Use:   "tree [channel id or URL]",
+	Short: "Display the hierarchy of channels, child channels, subchannels and sockets.",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  withRun(channelzTreeCommandRunWithError),
+}
+
+func init() {
+	channelzCmd.AddCommand(channelzTreeCmd)
+}
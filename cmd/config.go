@@ -0,0 +1,286 @@
+// Defines the commands managing the grpcdebug_config file
+
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"grpcdebug/transport"
+
+	"github.com/spf13/cobra"
+)
+
+// loadServerConfigs loads the config file in use, printing its warnings
+func loadServerConfigs() (*transport.ServerConfigs, error) {
+	configs, err := transport.LoadServerConfigs()
+	if err != nil {
+		return nil, err
+	}
+	if verboseFlag && configs.Path != "" {
+		fmt.Fprintf(os.Stderr, "Loaded server configs from %v\n", configs.Path)
+	}
+	for _, warning := range configs.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", warning)
+	}
+	return configs, nil
+}
+
+// redactedHeaders are printed without their values
+var redactedHeaders = map[string]bool{
+	"authorization": true,
+	"cookie":        true,
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
+
+// redactProxy hides the password of a proxy URL
+func redactProxy(proxy string) string {
+	if u, err := url.Parse(proxy); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			return u.Redacted()
+		}
+	}
+	return proxy
+}
+
+func (r *commandRun) printServerConfig(config transport.ServerConfig) {
+	fmt.Fprintf(r.w, "Target:\t%v\t\n", config.Target)
+	fmt.Fprintf(r.w, "Matched Pattern:\t%v\t\n", orNone(config.Pattern))
+	fmt.Fprintf(r.w, "Dial Address:\t%v\t\n", config.DialAddress())
+	fmt.Fprintf(r.w, "Security:\t%v\t\n", config.Security)
+	fmt.Fprintf(r.w, "CA File:\t%v\t\n", orNone(config.IdentityFile))
+	fmt.Fprintf(r.w, "Use System Roots:\t%v\t\n", config.UseSystemRoots)
+	fmt.Fprintf(r.w, "Client Certificate:\t%v\t\n", orNone(config.CertificateFile))
+	fmt.Fprintf(r.w, "Client Key:\t%v\t\n", orNone(config.KeyFile))
+	fmt.Fprintf(r.w, "Server Name Override:\t%v\t\n", orNone(config.ServerNameOverride))
+	fmt.Fprintf(r.w, "Google Credentials:\t%v\t\n", orNone(config.GoogleCredentialsFile))
+	fmt.Fprintf(r.w, "Token File:\t%v\t\n", orNone(config.TokenFile))
+	fmt.Fprintf(r.w, "Proxy:\t%v\t\n", orNone(redactProxy(config.ProxyJump)))
+	var headers []string
+	for _, header := range config.Headers {
+		if redactedHeaders[header.Key] {
+			headers = append(headers, header.Key+": <redacted>")
+		} else {
+			headers = append(headers, header.Key+": "+header.Value)
+		}
+	}
+	fmt.Fprintf(r.w, "Headers:\t%v\t\n", orNone(strings.Join(headers, ", ")))
+	r.w.Flush()
+}
+
+func configResolveCommandRunWithError(r *commandRun, cmd *cobra.Command, args []string) error {
+	config, err := resolveConfig(cmd, args[0])
+	if err != nil {
+		return err
+	}
+	r.printServerConfig(config)
+	return nil
+}
+
+var configResolveCmd = &cobra.Command{
+	Use:   "resolve <alias or address>",
+	Short: "Print the effective connection settings of a target.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  withRun(configResolveCommandRunWithError),
+}
+
+var strictFlag bool
+var realAddressFlag string
+
+// configFileForWrite returns the config file in use, or where to create one
+func configFileForWrite() (string, error) {
+	if path := transport.FindServerConfigFile(); path != "" {
+		return path, nil
+	}
+	return transport.DefaultServerConfigFile()
+}
+
+func configListCommandRunWithError(r *commandRun, cmd *cobra.Command, args []string) error {
+	configs, err := loadServerConfigs()
+	if err != nil {
+		return err
+	}
+	if configs.Path == "" {
+		fmt.Println("No config file found.")
+		return nil
+	}
+	fmt.Fprintln(r.w, "Current\tServer\tReal Address\tSecurity\tDefined At\t")
+	for _, config := range configs.Servers {
+		var current string
+		if config.Pattern == configs.CurrentTarget {
+			current = "*"
+		}
+		fmt.Fprintf(
+			r.w, "%v\t%v\t%v\t%v\t%v\t\n",
+			current,
+			config.Pattern,
+			orNone(config.RealAddress),
+			config.Security,
+			config.Position(),
+		)
+	}
+	r.w.Flush()
+	return nil
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the servers defined in the config file.",
+	Args:  cobra.NoArgs,
+	RunE:  withRun(configListCommandRunWithError),
+}
+
+func configShowCommandRunWithError(r *commandRun, cmd *cobra.Command, args []string) error {
+	configs, err := loadServerConfigs()
+	if err != nil {
+		return err
+	}
+	for _, config := range configs.Servers {
+		if config.Pattern == args[0] {
+			fmt.Printf("# %v\n", config.Position())
+			fmt.Print(transport.FormatServerConfig(config))
+			return nil
+		}
+	}
+	return fmt.Errorf("Server %v is not defined; use \"config resolve\" to see how a target is matched", args[0])
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show <alias>",
+	Short: "Print the Server block of an alias as defined in the config file.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  withRun(configShowCommandRunWithError),
+}
+
+func configAddCommandRunWithError(r *commandRun, cmd *cobra.Command, args []string) error {
+	config := transport.ServerConfig{Pattern: args[0], RealAddress: realAddressFlag}
+	if err := applyConnectionFlags(cmd, &config); err != nil {
+		return err
+	}
+	path, err := configFileForWrite()
+	if err != nil {
+		return err
+	}
+	if err := transport.AddServerConfig(path, config); err != nil {
+		return err
+	}
+	fmt.Printf("Added server %v to %v\n", config.Pattern, path)
+	return nil
+}
+
+var configAddCmd = &cobra.Command{
+	Use:   "add <alias or pattern>",
+	Short: "Add a server to the config file, using the connection flags given.",
+	Example: `  grpcdebug config add prod --real_address prod.example.com:50051 --security tls --use_system_roots
+  grpcdebug config add "*.internal" --proxy bastion.example.com`,
+	Args: cobra.ExactArgs(1),
+	RunE: withRun(configAddCommandRunWithError),
+}
+
+func configRemoveCommandRunWithError(r *commandRun, cmd *cobra.Command, args []string) error {
+	path := transport.FindServerConfigFile()
+	if path == "" {
+		return fmt.Errorf("No config file found.")
+	}
+	unset, err := transport.RemoveServerConfig(path, args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removed server %v from %v\n", args[0], path)
+	if unset != "" {
+		fmt.Printf("Unset the current target %v, which it configured\n", unset)
+	}
+	return nil
+}
+
+var configRemoveCmd = &cobra.Command{
+	Use:   "remove <alias>",
+	Short: "Remove a server from the config file.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  withRun(configRemoveCommandRunWithError),
+}
+
+func configUseCommandRunWithError(r *commandRun, cmd *cobra.Command, args []string) error {
+	var target string
+	if len(args) > 0 {
+		target = args[0]
+	}
+	path, err := configFileForWrite()
+	if err != nil {
+		return err
+	}
+	if err := transport.SetCurrentTarget(path, target); err != nil {
+		return err
+	}
+	if target == "" {
+		fmt.Printf("Unset the current target in %v\n", path)
+	} else {
+		fmt.Printf("Switched to target %v in %v\n", target, path)
+	}
+	return nil
+}
+
+var configUseCmd = &cobra.Command{
+	Use:   "use [alias or address]",
+	Short: "Set the target used when none is given on the command line; no argument unsets it.",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  withRun(configUseCommandRunWithError),
+}
+
+func configValidateCommandRunWithError(r *commandRun, cmd *cobra.Command, args []string) error {
+	var path string
+	if len(args) > 0 {
+		path = args[0]
+	} else if path = transport.FindServerConfigFile(); path == "" {
+		return fmt.Errorf("No config file found; set %v or create grpcdebug_config", transport.GrpcdebugServerConfigEnvName)
+	}
+	configs, err := transport.LoadServerConfigsFromFile(path)
+	if err != nil {
+		return err
+	}
+	problems := append(configs.Warnings, configs.Check()...)
+	for _, problem := range problems {
+		fmt.Printf("warning: %v\n", problem)
+	}
+	fmt.Printf("%v: %d server blocks, %d warnings\n", path, len(configs.Servers), len(problems))
+	if strictFlag && len(problems) > 0 {
+		return fmt.Errorf("%v has %d warnings", path, len(problems))
+	}
+	return nil
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [config file]",
+	Short: "Check the syntax and settings of a config file (default the one in use).",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  withRun(configValidateCommandRunWithError),
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the grpcdebug_config file.",
+	Args:  cobra.NoArgs,
+	// Config commands never connect to a target
+	Annotations: map[string]string{noConnectionAnnotation: ""},
+}
+
+func init() {
+	configValidateCmd.Flags().BoolVar(&strictFlag, "strict", false, "Fails if there is any warning")
+	configAddCmd.Flags().StringVar(&realAddressFlag, "real_address", "", "The address to dial instead of the alias")
+	configCmd.AddCommand(configListCmd)
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configAddCmd)
+	configCmd.AddCommand(configRemoveCmd)
+	configCmd.AddCommand(configUseCmd)
+	configCmd.AddCommand(configResolveCmd)
+	configCmd.AddCommand(configValidateCmd)
+	rootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,124 @@
+// Defines how partial failures are reported and mapped to exit codes
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// exitCodeFailure means the command failed without printing results.
+	exitCodeFailure = 1
+	// exitCodePartial means the command printed results, but some of the
+	// entities it tried to fetch failed.
+	exitCodePartial = 2
+	// exitCodeUnhealthy means the command printed a report in which some
+	// health checks exceeded their thresholds.
+	exitCodeUnhealthy = 3
+)
+
+// errHandled stops a command whose work was already done before it ran, like
+// printing the settings under --dry_run. It is not a failure.
+var errHandled = errors.New("handled")
+
+// partialError reports that a command printed its results, but failed to
+// fetch some of the entities it was asked to display.
+type partialError struct {
+	failed int
+	first  error
+}
+
+func (e *partialError) Error() string {
+	if e.failed == 1 {
+		return fmt.Sprintf("failed to fetch 1 entity: %v", e.first)
+	}
+	return fmt.Sprintf("failed to fetch %d entities, first error: %v", e.failed, e.first)
+}
+
+func (e *partialError) Unwrap() error {
+	return e.first
+}
+
+// targetsError reports that a command ran against several targets, and failed
+// against some of them while printing the results of the others.
+type targetsError struct {
+	total  int
+	failed int
+	first  error
+}
+
+func (e *targetsError) Error() string {
+	if e.failed == 1 {
+		return fmt.Sprintf("failed against 1 of %d targets: %v", e.total, e.first)
+	}
+	return fmt.Sprintf("failed against %d of %d targets, first error: %v", e.failed, e.total, e.first)
+}
+
+func (e *targetsError) Unwrap() error {
+	return e.first
+}
+
+// unhealthyError reports that a health report found problems.
+type unhealthyError struct {
+	breached int
+}
+
+func (e *unhealthyError) Error() string {
+	if e.breached == 1 {
+		return "1 health check failed"
+	}
+	return fmt.Sprintf("%d health checks failed", e.breached)
+}
+
+// fetchErrors accumulates per-entity failures while a command keeps rendering
+// whatever it managed to fetch.
+type fetchErrors struct {
+	failed int
+	first  error
+}
+
+func (f *fetchErrors) add(err error) {
+	if err == nil {
+		return
+	}
+	if f.first == nil {
+		f.first = err
+	}
+	f.failed++
+}
+
+// err returns a *partialError if any failure was recorded, or nil.
+func (f *fetchErrors) err() error {
+	if f.failed == 0 {
+		return nil
+	}
+	return &partialError{failed: f.failed, first: f.first}
+}
+
+// prettyError renders a per-entity error for the table's Error column.
+func prettyError(err error) string {
+	if err == nil {
+		return ""
+	}
+	s := status.Convert(err)
+	return fmt.Sprintf("%v: %v", s.Code(), s.Message())
+}
+
+func exitCode(err error) int {
+	var targets *targetsError
+	if errors.As(err, &targets) {
+		return exitCodePartial
+	}
+	var partial *partialError
+	if errors.As(err, &partial) {
+		return exitCodePartial
+	}
+	var unhealthy *unhealthyError
+	if errors.As(err, &unhealthy) {
+		return exitCodeUnhealthy
+	}
+	return exitCodeFailure
+}
@@ -0,0 +1,312 @@
+// Defines how a command runs against several targets at once
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"grpcdebug/transport"
+
+	"github.com/spf13/cobra"
+)
+
+var targetsFileFlag string
+var parallelismFlag int
+
+// The target arguments given before the command, which may be globs
+var targetArgs []string
+
+// expandTargets turns the target arguments into addresses. Arguments with a *
+// or ? select every alias of the config file they match, and the targets file
+// lists one address per line.
+func expandTargets(args []string, targetsFile string) ([]string, error) {
+	var targets []string
+	seen := make(map[string]bool)
+	add := func(target string) {
+		if !seen[target] {
+			seen[target] = true
+			targets = append(targets, target)
+		}
+	}
+	var configs *transport.ServerConfigs
+	for _, arg := range args {
+		if !strings.ContainsAny(arg, "*?") {
+			add(arg)
+			continue
+		}
+		if configs == nil {
+			var err error
+			if configs, err = transport.LoadServerConfigs(); err != nil {
+				return nil, err
+			}
+		}
+		matched := false
+		for _, config := range configs.Servers {
+			// Only aliases can be targets, not the wildcard blocks
+			if !strings.ContainsAny(config.Pattern, "*?") && transport.MatchPattern(arg, config.Pattern) {
+				add(config.Pattern)
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("No server alias in the config file matches %v", arg)
+		}
+	}
+	if targetsFile != "" {
+		file, err := os.Open(targetsFile)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			add(line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return targets, nil
+}
+
+// singleTargetAnnotation marks a command that only makes sense against one
+// target, like the interactive ones
+const singleTargetAnnotation = "grpcdebug_single_target"
+
+// checkFanOut rejects the commands and flags that cannot run against several
+// targets
+func checkFanOut(cmd *cobra.Command) error {
+	if parallelismFlag < 1 {
+		return fmt.Errorf("--parallelism must be positive")
+	}
+	if _, ok := cmd.Annotations[singleTargetAnnotation]; ok {
+		return fmt.Errorf("%v runs against a single target", cmd.CommandPath())
+	}
+	if watchFlag > 0 {
+		return fmt.Errorf("--watch runs against a single target")
+	}
+	return nil
+}
+
+// targetResult is the outcome of running the command against one target
+type targetResult struct {
+	target string
+	output bytes.Buffer
+	err    error
+}
+
+// newRun returns a run against the target that captures its output
+func (r *targetResult) newRun(client *transport.Client) *commandRun {
+	return &commandRun{client: client, out: &r.output, w: rawCells{&r.output}}
+}
+
+// failed reports whether the target printed no results
+func (r *targetResult) failed() bool {
+	return r.err != nil && exitCode(r.err) == exitCodeFailure
+}
+
+// rawCells stands in for the table writer while capturing the output of a
+// target, so that the tables of every target are aligned together at the end
+type rawCells struct {
+	io.Writer
+}
+
+func (rawCells) Flush() error { return nil }
+
+// fanOut runs the command against every target in this process, with at most
+// --parallelism targets connected to at once. Each target has its own client
+// and captures its own output, which is printed in target order once every
+// target is done.
+func fanOut(cmd *cobra.Command, args []string, targets []string, run runFunc) error {
+	ctx := cmd.Context()
+	results := make([]targetResult, len(targets))
+	semaphore := make(chan struct{}, parallelismFlag)
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		result := &results[i]
+		result.target = target
+		config, err := resolveConfig(cmd, target)
+		if err != nil {
+			result.err = err
+			continue
+		}
+		if dryRunFlag {
+			result.newRun(nil).printServerConfig(config)
+			continue
+		}
+		wg.Add(1)
+		go func(config transport.ServerConfig) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			client, err := connect(ctx, config)
+			if err != nil {
+				result.err = err
+				return
+			}
+			defer client.Close()
+			result.err = run(result.newRun(client), cmd, args)
+		}(config)
+	}
+	wg.Wait()
+	if allJSON(results) {
+		if err := printFanOutJSON(os.Stdout, results); err != nil {
+			return err
+		}
+	} else {
+		printFanOutText(os.Stdout, results)
+	}
+	return aggregateFanOut(results)
+}
+
+// allJSON reports whether every target that printed results printed a JSON
+// document
+func allJSON(results []targetResult) bool {
+	printed := 0
+	for _, result := range results {
+		if result.failed() {
+			continue
+		}
+		if !json.Valid(result.output.Bytes()) {
+			return false
+		}
+		printed++
+	}
+	return printed > 0
+}
+
+// printFanOutJSON prints one JSON array, with an element per target
+func printFanOutJSON(output io.Writer, results []targetResult) error {
+	type element struct {
+		Target string          `json:"target"`
+		Result json.RawMessage `json:"result,omitempty"`
+		Error  string          `json:"error,omitempty"`
+	}
+	var elements []element
+	for _, result := range results {
+		e := element{Target: result.target}
+		if !result.failed() {
+			e.Result = result.output.Bytes()
+		}
+		if result.err != nil {
+			e.Error = result.err.Error()
+		}
+		elements = append(elements, e)
+	}
+	return newCommandRun(nil, output).printAsJson(elements)
+}
+
+// tableHeaders returns the first lines of the tables in lines
+func tableHeaders(lines []string) map[string]bool {
+	headers := make(map[string]bool)
+	for i, line := range lines {
+		if startsTable(lines, i) {
+			headers[line] = true
+		}
+	}
+	return headers
+}
+
+func startsTable(lines []string, i int) bool {
+	return strings.Contains(lines[i], "\t") && (i == 0 || !strings.Contains(lines[i-1], "\t"))
+}
+
+// printFanOutText prints the output of every target with each line prefixed
+// by the target, then the errors. Tables are aligned across targets. The
+// first line of a table is a header if every target printed it; a table
+// continued by the next target keeps a single header.
+func printFanOutText(output io.Writer, results []targetResult) {
+	outputs := make([][]string, len(results))
+	var headers map[string]bool
+	for i, result := range results {
+		text := strings.TrimRight(result.output.String(), "\n")
+		if text == "" {
+			continue
+		}
+		outputs[i] = strings.Split(text, "\n")
+		targetHeaders := tableHeaders(outputs[i])
+		if headers == nil {
+			headers = targetHeaders
+			continue
+		}
+		for header := range headers {
+			if !targetHeaders[header] {
+				delete(headers, header)
+			}
+		}
+	}
+	tw := newTableWriter(output)
+	// The header of the table the last line printed belongs to, if any
+	header := ""
+	for i, result := range results {
+		lines := outputs[i]
+		for j, line := range lines {
+			isHeader := startsTable(lines, j) && headers[line]
+			switch {
+			case isHeader && j == 0 && line == header:
+				// The previous target ended with the same table
+			case isHeader:
+				header = line
+				fmt.Fprintf(tw, "\t%v\n", line)
+			default:
+				if startsTable(lines, j) || !strings.Contains(line, "\t") {
+					header = ""
+				}
+				fmt.Fprintf(tw, "%v\t%v\n", result.target, line)
+			}
+		}
+	}
+	tw.Flush()
+	tw = newTableWriter(os.Stderr)
+	for _, result := range results {
+		if result.err != nil {
+			fmt.Fprintf(tw, "%v\t%v\n", result.target, result.err)
+		}
+	}
+	tw.Flush()
+}
+
+// aggregateFanOut fails if every target failed, reports the failed targets if
+// only some did, and an unhealthy report if any report found problems
+func aggregateFanOut(results []targetResult) error {
+	var first error
+	breached, failed, withErrors := 0, 0, 0
+	for _, result := range results {
+		var unhealthy *unhealthyError
+		switch {
+		case result.err == nil:
+		case errors.As(result.err, &unhealthy):
+			breached += unhealthy.breached
+		default:
+			if result.failed() {
+				failed++
+			}
+			if first == nil {
+				first = fmt.Errorf("%v: %v", result.target, result.err)
+			}
+			withErrors++
+		}
+	}
+	if failed == len(results) {
+		return fmt.Errorf("all %d targets failed, first error: %v", len(results), first)
+	}
+	if withErrors > 0 {
+		return &targetsError{total: len(results), failed: withErrors, first: first}
+	}
+	if breached > 0 {
+		return &unhealthyError{breached: breached}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func fanOutResult(target, output string, err error) targetResult {
+	result := targetResult{target: target, err: err}
+	result.output.WriteString(output)
+	return result
+}
+
+func TestPrintFanOutText(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		outputs []string
+		want    []string
+	}{
+		{
+			name:    "one header",
+			outputs: []string{"ID\tState\t\n1\tREADY\t\n", "ID\tState\t\n2\tTRANSIENT_FAILURE\t\n"},
+			want: []string{
+				"          ID        State               ",
+				"a         1         READY               ",
+				"bb        2         TRANSIENT_FAILURE   ",
+			},
+		},
+		{
+			name:    "sections",
+			outputs: []string{"ID\t\n1\t\n---\nfinding\n", "ID\t\n2\t\n---\n"},
+			want: []string{
+				"          ID        ",
+				"a         1         ",
+				"a         ---",
+				"a         finding",
+				"          ID        ",
+				"bb        2         ",
+				"bb        ---",
+			},
+		},
+		{
+			name:    "tables without a common header",
+			outputs: []string{"Target:\ta\t\n", "Target:\tbb\t\n"},
+			want: []string{
+				"a         Target:   a         ",
+				"bb        Target:   bb        ",
+			},
+		},
+		{
+			name:    "failed target",
+			outputs: []string{"ID\t\n1\t\n", ""},
+			want: []string{
+				"          ID        ",
+				"a         1         ",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			results := []targetResult{fanOutResult("a", test.outputs[0], nil), fanOutResult("bb", test.outputs[1], nil)}
+			var buf bytes.Buffer
+			printFanOutText(&buf, results)
+			if got, want := buf.String(), strings.Join(test.want, "\n")+"\n"; got != want {
+				t.Errorf("printFanOutText() printed\n%v\nwant\n%v", got, want)
+			}
+		})
+	}
+}
+
+func TestAggregateFanOut(t *testing.T) {
+	failure := fmt.Errorf("unavailable")
+	partial := &partialError{failed: 1, first: failure}
+	unhealthy := &unhealthyError{breached: 2}
+	for _, test := range []struct {
+		name         string
+		errs         []error
+		wantExitCode int
+	}{
+		{"all succeeded", []error{nil, nil}, 0},
+		{"all failed", []error{failure, failure}, exitCodeFailure},
+		{"some failed", []error{nil, failure}, exitCodePartial},
+		{"partial results", []error{partial, partial}, exitCodePartial},
+		{"unhealthy", []error{nil, unhealthy}, exitCodeUnhealthy},
+		{"unhealthy and failed", []error{failure, unhealthy}, exitCodePartial},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var results []targetResult
+			for i, err := range test.errs {
+				results = append(results, fanOutResult(fmt.Sprintf("target-%d", i), "", err))
+			}
+			err := aggregateFanOut(results)
+			if err == nil {
+				if test.wantExitCode != 0 {
+					t.Errorf("aggregateFanOut() succeeded, want exit code %v", test.wantExitCode)
+				}
+				return
+			}
+			if got := exitCode(err); got != test.wantExitCode {
+				t.Errorf("exitCode(aggregateFanOut()) = %v, want %v: %v", got, test.wantExitCode, err)
+			}
+		})
+	}
+}
+
+func TestAggregateFanOutReportsTargets(t *testing.T) {
+	results := []targetResult{
+		fanOutResult("staging", "", nil),
+		fanOutResult("prod", "", fmt.Errorf("unavailable")),
+		fanOutResult("canary", "", &partialError{failed: 1, first: fmt.Errorf("not found")}),
+	}
+	want := "failed against 2 of 3 targets, first error: prod: unavailable"
+	if err := aggregateFanOut(results); err == nil || err.Error() != want {
+		t.Errorf("aggregateFanOut() = %v, want %q", err, want)
+	}
+}
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"grpcdebug/transport"
 
 	"github.com/spf13/cobra"
 )
@@ -10,21 +9,31 @@ import (
 var healthCmd = &cobra.Command{
 	Use:   "health [service names...]",
 	Short: "Check health status of the target service (default \"\").",
-	RunE: func(cmd *cobra.Command, args []string) error {
+	RunE: withRun(func(r *commandRun, cmd *cobra.Command, args []string) error {
 		if len(args) == 0 {
-			fmt.Println(transport.GetHealthStatus(""))
+			status, err := r.client.GetHealthStatus(cmd.Context(), "")
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(r.out, status)
 			return nil
 		}
+		var errs fetchErrors
 		for _, service := range args {
+			status, err := r.client.GetHealthStatus(cmd.Context(), service)
+			if err != nil {
+				errs.add(err)
+				status = prettyError(err)
+			}
 			fmt.Fprintf(
-				w, "%v:\t%v\t\n",
+				r.w, "%v:\t%v\t\n",
 				service,
-				transport.GetHealthStatus(service),
+				status,
 			)
-			w.Flush()
+			r.w.Flush()
 		}
-		return nil
-	},
+		return errs.err()
+	}),
 }
 
 func init() {
@@ -3,9 +3,12 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"time"
 
 	"grpcdebug/transport"
 
@@ -14,10 +17,27 @@ import (
 
 var verboseFlag, timestampFlag bool
 var address, security, credFile, serverNameOverride string
+var clientCertFile, clientKeyFile, googleCredentialsFile string
+var useSystemRootsFlag bool
+var headerFlags []string
+var tokenFile string
+var dryRunFlag bool
+var proxyFlag string
+var maxResultsFlag int64
+var limitFlag int
+var timeoutFlag, connectTimeoutFlag time.Duration
+var maxRetriesFlag int
+var concurrencyFlag int
+
+// The client of the target, connected before any command that needs it runs
+var targetClient *transport.Client
+
+// The targets the command runs against, when there are several
+var fanOutTargets []string
 
 var rootUsageTemplate = `Usage:{{if .Runnable}}
   {{.UseLine}}{{end}}{{if .HasAvailableSubCommands}}
-  grpcdebug <target address> [flags] {{ .CommandPath | ChildCommandPath }} <command>{{end}}{{if gt (len .Aliases) 0}}
+  grpcdebug [target addresses...] [flags] {{with ChildCommandPath .CommandPath}}{{.}} {{end}}<command>{{end}}{{if gt (len .Aliases) 0}}
 
 Aliases:
   {{.NameAndAliases}}{{end}}{{if .HasExample}}
@@ -37,67 +57,259 @@ Global Flags:
 Additional help topics:{{range .Commands}}{{if .IsAdditionalHelpTopicCommand}}
   {{rpad .CommandPath .CommandPathPadding}} {{.Short}}{{end}}{{end}}{{end}}{{if .HasAvailableSubCommands}}
 
-Use "grpcdebug <target address> {{ .CommandPath | ChildCommandPath }} [command] --help" for more information about a command.{{end}}
+Use "grpcdebug [target address] {{with ChildCommandPath .CommandPath}}{{.}} {{end}}[command] --help" for more information about a command.{{end}}
 `
 
 var rootCmd = &cobra.Command{
-	Use:   "grpcdebug",
-	Short: "grpcdebug is an gRPC service admin CLI",
+	Use:               "grpcdebug",
+	Short:             "grpcdebug is an gRPC service admin CLI",
+	PersistentPreRunE: initConfig,
+	// Errors are printed once by Execute, which also picks the exit code
+	SilenceErrors: true,
+}
+
+// resolveConfig looks up target in the config files, then applies the command
+// line flags on top, which always win. An empty target means the current
+// target set by "config use".
+func resolveConfig(cmd *cobra.Command, target string) (transport.ServerConfig, error) {
+	configs, err := loadServerConfigs()
+	if err != nil {
+		return transport.ServerConfig{}, err
+	}
+	if target == "" {
+		if configs.CurrentTarget == "" {
+			return transport.ServerConfig{}, fmt.Errorf("Please specify the target address, or set one with \"grpcdebug config use\".")
+		}
+		target = configs.CurrentTarget
+	}
+	config := transport.MatchServerConfig(configs, target)
+	config.Target = target
+	if err := applyConnectionFlags(cmd, &config); err != nil {
+		return config, err
+	}
+	if config.Security == transport.TypeTls && config.IdentityFile == "" && !config.UseSystemRoots {
+		return config, fmt.Errorf("Please specify credential file or --use_system_roots under [tls] mode.")
+	}
+	if (config.CertificateFile == "") != (config.KeyFile == "") {
+		return config, fmt.Errorf("Please specify both --client_cert_file and --client_key_file for mutual TLS.")
+	}
+	return config, nil
 }
 
-func initConfig() {
-	config := transport.GetServerConfig(address)
+// applyConnectionFlags overrides config with the connection flags given on
+// the command line
+func applyConnectionFlags(cmd *cobra.Command, config *transport.ServerConfig) error {
 	if credFile != "" {
 		config.IdentityFile = credFile
 	}
 	if serverNameOverride != "" {
 		config.ServerNameOverride = serverNameOverride
 	}
-	if security == "tls" {
-		config.Security = transport.TypeTls
-		if config.IdentityFile == "" {
-			rootCmd.Usage()
-			log.Fatalf("Please specify credential file under [tls] mode.")
+	if clientCertFile != "" {
+		config.CertificateFile = clientCertFile
+	}
+	if clientKeyFile != "" {
+		config.KeyFile = clientKeyFile
+	}
+	if useSystemRootsFlag {
+		config.UseSystemRoots = true
+	}
+	if googleCredentialsFile != "" {
+		config.GoogleCredentialsFile = googleCredentialsFile
+	}
+	for _, value := range headerFlags {
+		header, err := transport.ParseHeader(value)
+		if err != nil {
+			// The usage message would bury which header is malformed
+			cmd.SilenceUsage = true
+			return err
 		}
-	} else if security != "insecure" {
-		rootCmd.Usage()
-		log.Fatalf("Unrecognized security mode: %v", security)
+		config.Headers = append(config.Headers, header)
+	}
+	if tokenFile != "" {
+		config.TokenFile = tokenFile
 	}
-	transport.Connect(address, config.IdentityFile, config.ServerNameOverride)
+	if proxyFlag != "" {
+		config.ProxyJump = proxyFlag
+	}
+	// The config file decides the security model unless the flag is given
+	if cmd.Flags().Changed("security") {
+		securityType, err := transport.ParseSecurityType(security)
+		if err != nil {
+			return fmt.Errorf("Unrecognized security mode: %v", security)
+		}
+		config.Security = securityType
+	}
+	return nil
 }
 
-// ChildCommandPath used in template
-func ChildCommandPath(path string) string {
-	if len(path) <= 7 {
-		return ""
+// noConnectionAnnotation marks a command, and its subcommands, as never
+// connecting to a target
+const noConnectionAnnotation = "grpcdebug_no_connection"
+
+// needsConnection reports whether cmd talks to a target. Cobra's help and
+// completion commands, and commands annotated with noConnectionAnnotation, do
+// not.
+func needsConnection(cmd *cobra.Command) bool {
+	if cmd.HasParent() && !cmd.Parent().HasParent() && isBuiltinCommand(cmd.Name()) {
+		return false
 	}
-	return path[7:]
+	for c := cmd; c != nil; c = c.Parent() {
+		if _, ok := c.Annotations[noConnectionAnnotation]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+// isBuiltinCommand reports whether name is one of the commands cobra adds on
+// its own when executing
+func isBuiltinCommand(name string) bool {
+	switch name {
+	case "help", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+		return true
+	}
+	return false
+}
+
+func initConfig(cmd *cobra.Command, args []string) error {
+	if !needsConnection(cmd) {
+		cmd.SilenceUsage = true
+		if len(targetArgs) > 1 || targetsFileFlag != "" {
+			return fmt.Errorf("%v does not connect to a target, and cannot run against several", cmd.CommandPath())
+		}
+		return nil
+	}
+	targets, err := expandTargets(targetArgs, targetsFileFlag)
+	if err != nil {
+		cmd.SilenceUsage = true
+		return err
+	}
+	if maxResultsFlag < 0 || limitFlag < 0 {
+		return fmt.Errorf("--max_results and --limit must not be negative")
+	}
+	if timeoutFlag < 0 || connectTimeoutFlag < 0 || maxRetriesFlag < 0 {
+		return fmt.Errorf("--timeout, --connect_timeout and --max_retries must not be negative")
+	}
+	if concurrencyFlag < 1 {
+		return fmt.Errorf("--concurrency must be positive")
+	}
+	if len(targets) > 1 {
+		cmd.SilenceUsage = true
+		if err := checkFanOut(cmd); err != nil {
+			return err
+		}
+		// The command connects to each target as it runs
+		fanOutTargets = targets
+		return nil
+	}
+	if len(targets) == 1 {
+		address = targets[0]
+	}
+	config, err := resolveConfig(cmd, address)
+	if err != nil {
+		return err
+	}
+	// The address may come from the current target of the config file
+	address = config.Target
+	// From here on, failures are about the target rather than the command
+	// line, so the usage message would only be noise.
+	cmd.SilenceUsage = true
+	if dryRunFlag {
+		newCommandRun(nil, os.Stdout).printServerConfig(config)
+		return errHandled
+	}
+	targetClient, err = connect(cmd.Context(), config)
+	return err
+}
+
+// connect creates the client of the target, waiting for the connection for
+// at most --connect_timeout
+func connect(ctx context.Context, config transport.ServerConfig) (*transport.Client, error) {
+	if connectTimeoutFlag > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, connectTimeoutFlag)
+		defer cancel()
+	}
+	return transport.NewClient(
+		ctx, config,
+		transport.WithPagination(maxResultsFlag, limitFlag),
+		transport.WithCallPolicy(timeoutFlag, maxRetriesFlag),
+		transport.WithConcurrency(concurrencyFlag),
+	)
+}
+
+// isCommandName reports whether arg names a top-level command rather than a
+// target address
+func isCommandName(arg string) bool {
+	if isBuiltinCommand(arg) || arg == "-h" || arg == "--help" {
+		return true
+	}
+	for _, c := range rootCmd.Commands() {
+		if c.Name() == arg || c.HasAlias(arg) {
+			return true
+		}
+	}
+	return false
+}
+
+// ChildCommandPath used in template, strips the program name from the path
+func ChildCommandPath(path string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(path, "grpcdebug"), " ")
 }
 
 func init() {
 	cobra.AddTemplateFunc("ChildCommandPath", ChildCommandPath)
-	cobra.OnInitialize(initConfig)
 
 	rootCmd.SetUsageTemplate(rootUsageTemplate)
 
 	rootCmd.PersistentFlags().BoolVarP(&verboseFlag, "verbose", "v", false, "Print verbose information for debugging")
 	rootCmd.PersistentFlags().BoolVarP(&timestampFlag, "timestamp", "t", false, "Print timestamp as RFC3339 instead of human readable strings")
 	rootCmd.PersistentFlags().StringVar(&security, "security", "insecure", "Defines the type of credentials to use [tls, google-default, insecure]")
-	rootCmd.PersistentFlags().StringVar(&credFile, "credential_file", "", "Sets the path of the credential file; used in [tls] mode")
-	rootCmd.PersistentFlags().StringVar(&serverNameOverride, "server_name_override", "", "Overrides the peer server name if non empty; used in [tls] mode")
+	rootCmd.PersistentFlags().StringVar(&credFile, "credential_file", "", "Sets the path of the CA certificate file; used in [tls, google-default] mode")
+	rootCmd.PersistentFlags().StringVar(&serverNameOverride, "server_name_override", "", "Overrides the peer server name if non empty; used in [tls, google-default] mode")
+	rootCmd.PersistentFlags().StringVar(&clientCertFile, "client_cert_file", "", "Sets the path of the client certificate for mutual TLS; used in [tls, google-default] mode")
+	rootCmd.PersistentFlags().StringVar(&clientKeyFile, "client_key_file", "", "Sets the path of the client private key for mutual TLS; used in [tls, google-default] mode")
+	rootCmd.PersistentFlags().BoolVar(&useSystemRootsFlag, "use_system_roots", false, "Trusts the system root CAs, in addition to the credential file; used in [tls] mode")
+	rootCmd.PersistentFlags().StringVar(&googleCredentialsFile, "google_credentials_file", "", "Sets the path of the application default credentials; used in [google-default] mode")
+	rootCmd.PersistentFlags().StringArrayVarP(&headerFlags, "header", "H", nil, "Attaches a key:value header to every admin RPC; may be repeated")
+	rootCmd.PersistentFlags().StringVar(&tokenFile, "token_file", "", "Sets the path of a file holding a bearer token for the authorization header")
+	rootCmd.PersistentFlags().StringVar(&proxyFlag, "proxy", "", "Tunnels the connection through an HTTP CONNECT proxy (http://host:port) or an SSH jump host ([user@]host[:port]); \"none\" disables the configured one")
+	rootCmd.PersistentFlags().BoolVar(&dryRunFlag, "dry_run", false, "Prints the effective connection settings of the target instead of running the command")
+	rootCmd.PersistentFlags().StringVar(&targetsFileFlag, "targets_file", "", "Reads additional targets from a file, one address per line")
+	rootCmd.PersistentFlags().IntVar(&parallelismFlag, "parallelism", 8, "Sets how many targets are queried at once")
+	rootCmd.PersistentFlags().Int64Var(&maxResultsFlag, "max_results", 0, "Sets the page size of channelz list RPCs; 0 lets the server decide")
+	rootCmd.PersistentFlags().DurationVar(&timeoutFlag, "timeout", 10*time.Second, "Sets the deadline of each admin RPC, including retries; 0 means no deadline")
+	rootCmd.PersistentFlags().DurationVar(&connectTimeoutFlag, "connect_timeout", 5*time.Second, "Sets how long to wait for the connection to be ready; 0 means no deadline")
+	rootCmd.PersistentFlags().IntVar(&maxRetriesFlag, "max_retries", 2, "Sets how many times an admin RPC is retried when the target is UNAVAILABLE")
+	rootCmd.PersistentFlags().IntVar(&concurrencyFlag, "concurrency", transport.DefaultConcurrency, "Caps how many channelz RPCs are in flight at once")
+	rootCmd.PersistentFlags().IntVar(&limitFlag, "limit", 0, "Caps the number of channels, servers or server sockets fetched per listing; 0 means unlimited")
 }
 
 // Execute executes the root command.
 func Execute() {
-	if len(os.Args) > 1 {
-		address = os.Args[1]
-		os.Args = os.Args[1:]
-	} else {
+	if len(os.Args) <= 1 {
 		rootCmd.Usage()
 		os.Exit(1)
 	}
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	// Every argument before the command or the first flag is a target.
+	// Commands that need no target can be run without one.
+	i := 1
+	for i < len(os.Args) && !isCommandName(os.Args[i]) && !strings.HasPrefix(os.Args[i], "-") {
+		targetArgs = append(targetArgs, os.Args[i])
+		i++
+	}
+	os.Args = append([]string{os.Args[0]}, os.Args[i:]...)
+	// Interrupting cancels in-flight RPCs instead of killing the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err := rootCmd.ExecuteContext(ctx)
+	if targetClient != nil {
+		targetClient.Close()
+	}
+	if err != nil && err != errHandled {
+		fmt.Fprintln(os.Stderr, err)
+		stop()
+		os.Exit(exitCode(err))
 	}
 }
@@ -0,0 +1,41 @@
+// Defines what a command works with when it runs against one target
+
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"grpcdebug/transport"
+
+	"github.com/spf13/cobra"
+)
+
+// commandRun is what a command works with when it runs against one target:
+// the client of the target, and where it prints. Each target of a fan-out has
+// its own, so that they can run concurrently.
+type commandRun struct {
+	client *transport.Client
+	out    io.Writer
+	w      tableWriter
+	// The watcher of the run, or nil if it is not watched
+	watching *watcher
+}
+
+func newCommandRun(client *transport.Client, output io.Writer) *commandRun {
+	return &commandRun{client: client, out: output, w: newTableWriter(output)}
+}
+
+// runFunc is the body of a command, run against one target
+type runFunc func(r *commandRun, cmd *cobra.Command, args []string) error
+
+// withRun adapts the body of a command to cobra. It runs against the target
+// connected to by the root command, or against each of several targets.
+func withRun(run runFunc) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		if len(fanOutTargets) > 1 {
+			return fanOut(cmd, args, fanOutTargets, run)
+		}
+		return run(newCommandRun(targetClient, os.Stdout), cmd, args)
+	}
+}
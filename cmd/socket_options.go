@@ -0,0 +1,149 @@
+// Defines how the channelz socket options are decoded and displayed
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	durationpb "github.com/golang/protobuf/ptypes/duration"
+	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+)
+
+// tcpStates names the values of tcpi_state, see include/net/tcp_states.h
+var tcpStates = map[uint32]string{
+	1:  "ESTABLISHED",
+	2:  "SYN_SENT",
+	3:  "SYN_RECV",
+	4:  "FIN_WAIT1",
+	5:  "FIN_WAIT2",
+	6:  "TIME_WAIT",
+	7:  "CLOSE",
+	8:  "CLOSE_WAIT",
+	9:  "LAST_ACK",
+	10: "LISTEN",
+	11: "CLOSING",
+}
+
+// tcpCaStates names the values of tcpi_ca_state, the congestion control state
+var tcpCaStates = map[uint32]string{
+	0: "Open",
+	1: "Disorder",
+	2: "CWR",
+	3: "Recovery",
+	4: "Loss",
+}
+
+// The ssthresh the kernel reports until slow start ends
+const infiniteSsthresh = 0x7fffffff
+
+func prettyDuration(d *durationpb.Duration) string {
+	duration, err := ptypes.Duration(d)
+	if err != nil {
+		return d.String()
+	}
+	return duration.String()
+}
+
+// micros renders a TCP_INFO field counted in microseconds
+func micros(v uint32) string {
+	return (time.Duration(v) * time.Microsecond).String()
+}
+
+// millisAgo renders a TCP_INFO field counting milliseconds since an event
+func millisAgo(v uint32) string {
+	return fmt.Sprintf("%v ago", time.Duration(v)*time.Millisecond)
+}
+
+func prettyTcpState(state uint32) string {
+	if name, ok := tcpStates[state]; ok {
+		return name
+	}
+	return fmt.Sprintf("UNKNOWN(%d)", state)
+}
+
+func prettyTcpCaState(state uint32) string {
+	if name, ok := tcpCaStates[state]; ok {
+		return name
+	}
+	return fmt.Sprintf("Unknown(%d)", state)
+}
+
+// decodeSocketOption renders the value of an option. The TCP_INFO payload is
+// returned apart, since it is too large for a table cell.
+func decodeSocketOption(option *zpb.SocketOption) (string, *zpb.SocketOptionTcpInfo) {
+	if option.Value != "" {
+		// Prefer human readable value than the Any proto
+		return option.Value, nil
+	}
+	if option.Additional == nil {
+		return "", nil
+	}
+	switch {
+	case ptypes.Is(option.Additional, &zpb.SocketOptionTimeout{}):
+		var timeout zpb.SocketOptionTimeout
+		if err := ptypes.UnmarshalAny(option.Additional, &timeout); err == nil {
+			if d, _ := ptypes.Duration(timeout.Duration); d == 0 {
+				return "none", nil
+			}
+			return prettyDuration(timeout.Duration), nil
+		}
+	case ptypes.Is(option.Additional, &zpb.SocketOptionLinger{}):
+		var linger zpb.SocketOptionLinger
+		if err := ptypes.UnmarshalAny(option.Additional, &linger); err == nil {
+			if !linger.Active {
+				return "off", nil
+			}
+			return fmt.Sprintf("on, %v", prettyDuration(linger.Duration)), nil
+		}
+	case ptypes.Is(option.Additional, &zpb.SocketOptionTcpInfo{}):
+		var tcpInfo zpb.SocketOptionTcpInfo
+		if err := ptypes.UnmarshalAny(option.Additional, &tcpInfo); err == nil {
+			return "see below", &tcpInfo
+		}
+	}
+	return option.Additional.String(), nil
+}
+
+// printSocketOptions prints the option table, then the TCP_INFO section if
+// the socket reports it
+func (r *commandRun) printSocketOptions(options []*zpb.SocketOption) {
+	var tcpInfo *zpb.SocketOptionTcpInfo
+	fmt.Fprintln(r.w, "Socket Options Name\tValue\t")
+	for _, option := range options {
+		value, info := decodeSocketOption(option)
+		if info != nil {
+			tcpInfo = info
+		}
+		fmt.Fprintf(r.w, "%v\t%v\t\n", option.Name, value)
+	}
+	r.w.Flush()
+	if tcpInfo != nil {
+		fmt.Fprintln(r.out, "---")
+		r.printTcpInfo(tcpInfo)
+	}
+}
+
+func (r *commandRun) printTcpInfo(info *zpb.SocketOptionTcpInfo) {
+	ssthresh := fmt.Sprint(info.TcpiSndSsthresh)
+	if info.TcpiSndSsthresh >= infiniteSsthresh {
+		ssthresh = "infinite"
+	}
+	fmt.Fprintf(r.w, "TCP State:\t%v\t\n", prettyTcpState(info.TcpiState))
+	fmt.Fprintf(r.w, "Congestion State:\t%v\t\n", prettyTcpCaState(info.TcpiCaState))
+	fmt.Fprintf(r.w, "RTT:\t%v\t\n", micros(info.TcpiRtt))
+	fmt.Fprintf(r.w, "RTT Variance:\t%v\t\n", micros(info.TcpiRttvar))
+	fmt.Fprintf(r.w, "Retransmission Timeout:\t%v\t\n", micros(info.TcpiRto))
+	fmt.Fprintf(r.w, "Congestion Window:\t%v segments\t\n", info.TcpiSndCwnd)
+	fmt.Fprintf(r.w, "Slow Start Threshold:\t%v\t\n", ssthresh)
+	fmt.Fprintf(r.w, "Retransmits:\t%v\t\n", info.TcpiRetransmits)
+	fmt.Fprintf(r.w, "Retransmitted Segments:\t%v\t\n", info.TcpiRetrans)
+	fmt.Fprintf(r.w, "Lost Segments:\t%v\t\n", info.TcpiLost)
+	fmt.Fprintf(r.w, "Unacked Segments:\t%v\t\n", info.TcpiUnacked)
+	fmt.Fprintf(r.w, "MSS (Send/Receive):\t%v/%v\t\n", info.TcpiSndMss, info.TcpiRcvMss)
+	fmt.Fprintf(r.w, "Path MTU:\t%v\t\n", info.TcpiPmtu)
+	fmt.Fprintf(r.w, "Last Data Sent:\t%v\t\n", millisAgo(info.TcpiLastDataSent))
+	fmt.Fprintf(r.w, "Last Data Received:\t%v\t\n", millisAgo(info.TcpiLastDataRecv))
+	r.w.Flush()
+}
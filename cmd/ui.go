@@ -0,0 +1,307 @@
+// Defines the ui command, a full-screen browser of the channelz state
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+)
+
+var refreshFlag time.Duration
+
+const uiHelp = "↑↓ move  ⏎/→ open  ←/esc back  tab channels/servers  / search  t trace  r refresh  q quit"
+
+// ui holds the state of the browser: a stack of pages, the top one shown
+type ui struct {
+	pages       []*uiPage
+	searching   bool
+	showTrace   bool
+	refreshedAt time.Time
+	// Set while the current page is being loaded, which happens in the
+	// background so keys are still handled
+	loading bool
+	// Counts the loads started, so only the latest one is shown
+	generation int
+}
+
+// uiLoad is the result of loading a page in the background
+type uiLoad struct {
+	generation int
+	page       *uiPage
+}
+
+func (u *ui) page() *uiPage {
+	return u.pages[len(u.pages)-1]
+}
+
+// move moves the cursor by delta rows, staying within the visible rows
+func (u *ui) move(delta int) {
+	p := u.page()
+	p.selected += delta
+	if n := len(p.visibleRows()); p.selected >= n {
+		p.selected = n - 1
+	}
+	if p.selected < 0 {
+		p.selected = 0
+	}
+}
+
+// open pushes the page of the selected row
+func (u *ui) open() *uiPage {
+	rows := u.page().visibleRows()
+	if len(rows) == 0 {
+		return nil
+	}
+	row := rows[u.page().selected]
+	page := &uiPage{kind: row.kind, id: row.id}
+	u.pages = append(u.pages, page)
+	return page
+}
+
+// back pops the current page, unless it is a top level list
+func (u *ui) back() bool {
+	if len(u.pages) == 1 {
+		return false
+	}
+	u.pages = u.pages[:len(u.pages)-1]
+	return true
+}
+
+// render lays out the current page into screen lines
+func (u *ui) render(rows int) []styledLine {
+	p := u.page()
+	var lines []styledLine
+	tabs := "[Channels] Servers "
+	if u.pages[0].kind == serversPage {
+		tabs = " Channels [Servers]"
+	}
+	var path string
+	for _, page := range u.pages[1:] {
+		path += " > " + page.title()
+	}
+	refreshed := "refreshed " + u.refreshedAt.Format("15:04:05")
+	if u.loading && !p.loaded {
+		refreshed = "loading..."
+	}
+	lines = append(lines, styledLine{
+		text:  fmt.Sprintf(" grpcdebug ui  %v  %v%v   %v", address, tabs, path, refreshed),
+		style: inverseStyle,
+	})
+	for _, detail := range p.details {
+		lines = append(lines, styledLine{text: fmt.Sprintf(" %-36v %v", detail[0]+":", detail[1])})
+	}
+	if p.err != nil {
+		lines = append(lines, styledLine{text: " Error: " + prettyError(p.err), style: boldStyle})
+	}
+	// The trace pane takes up to a third of the screen at the bottom
+	var traceLines []styledLine
+	if u.showTrace && p.trace != nil {
+		traceLines = traceEventLines(p.trace, rows/3)
+	}
+	visible := p.visibleRows()
+	if len(visible) > 0 || len(p.rows) > 0 {
+		if len(p.details) > 0 || p.err != nil {
+			lines = append(lines, styledLine{})
+		}
+		formatted := formatRows(p.header, visible)
+		lines = append(lines, styledLine{text: " " + formatted[0], style: boldStyle})
+		// Scroll the list so the cursor stays on screen, keeping room for the
+		// trace pane and the status line
+		room := rows - len(lines) - len(traceLines) - 1
+		if room < 1 {
+			room = 1
+		}
+		first := 0
+		if p.selected >= room {
+			first = p.selected - room + 1
+		}
+		for i := first; i < len(visible) && i < first+room; i++ {
+			line := styledLine{text: " " + formatted[i+1]}
+			if i == p.selected {
+				line.style = inverseStyle
+			}
+			lines = append(lines, line)
+		}
+	}
+	// Push the trace pane and the status line to the bottom
+	for len(lines) < rows-len(traceLines)-1 {
+		lines = append(lines, styledLine{})
+	}
+	lines = append(lines, traceLines...)
+	status := uiHelp
+	if u.searching || p.filter != "" {
+		status = fmt.Sprintf("/%v", p.filter)
+		if u.searching {
+			status += "_"
+		}
+	}
+	lines = append(lines, styledLine{text: " " + status, style: inverseStyle})
+	return lines
+}
+
+// traceEventLines renders the latest trace events that fit in height lines
+func traceEventLines(trace *zpb.ChannelTrace, height int) []styledLine {
+	events := trace.GetEvents()
+	title := fmt.Sprintf(" Trace: %v events", len(events))
+	if logged := trace.GetNumEventsLogged(); logged > int64(len(events)) {
+		title += fmt.Sprintf(", %v dropped", logged-int64(len(events)))
+	}
+	lines := []styledLine{{text: title, style: boldStyle}}
+	if height < 2 {
+		return lines
+	}
+	if len(events) > height-1 {
+		events = events[len(events)-height+1:]
+	}
+	for _, event := range events {
+		description := event.Description
+		if ref := event.GetChannelRef(); ref != nil {
+			description += fmt.Sprintf(" (channel %v)", ref.ChannelId)
+		} else if ref := event.GetSubchannelRef(); ref != nil {
+			description += fmt.Sprintf(" (subchannel %v)", ref.SubchannelId)
+		}
+		lines = append(lines, styledLine{text: fmt.Sprintf(
+			" %-8v %-20v %v",
+			prettySeverity(event.Severity),
+			prettyTime(event.Timestamp),
+			description,
+		)})
+	}
+	return lines
+}
+
+func uiCommandRunWithError(r *commandRun, cmd *cobra.Command, args []string) error {
+	if refreshFlag <= 0 {
+		return fmt.Errorf("--refresh must be positive")
+	}
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return fmt.Errorf("the ui command needs an interactive terminal")
+	}
+	ctx := cmd.Context()
+	term, err := openTerminal()
+	if err != nil {
+		return err
+	}
+	defer term.Close()
+	keys := make(chan string)
+	go readKeys(os.Stdin, keys)
+	ticker := time.NewTicker(refreshFlag)
+	defer ticker.Stop()
+	u := &ui{pages: []*uiPage{{kind: channelsPage}}, showTrace: true}
+	// Loads run in the background. Starting one cancels the previous one,
+	// whose result would be stale anyway.
+	loads := make(chan uiLoad)
+	cancelLoad := func() {}
+	defer func() { cancelLoad() }()
+	reload := func() {
+		cancelLoad()
+		var loadCtx context.Context
+		loadCtx, cancelLoad = context.WithCancel(ctx)
+		u.generation++
+		u.loading = true
+		generation, page := u.generation, &uiPage{kind: u.page().kind, id: u.page().id}
+		go func() {
+			page.load(loadCtx, r.client)
+			select {
+			case loads <- uiLoad{generation: generation, page: page}:
+			case <-loadCtx.Done():
+			}
+		}()
+	}
+	reload()
+	for {
+		rows, _ := term.size()
+		term.draw(u.render(rows))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			// A target slower than the refresh interval keeps its load going
+			if !u.loading {
+				reload()
+			}
+		case load := <-loads:
+			if load.generation == u.generation {
+				u.page().show(load.page)
+				u.loading = false
+				u.refreshedAt = time.Now()
+				u.move(0)
+			}
+		case key, ok := <-keys:
+			if !ok || key == keyCtrlC {
+				return nil
+			}
+			p := u.page()
+			if u.searching {
+				switch key {
+				case keyEnter:
+					u.searching = false
+				case keyEsc:
+					u.searching, p.filter = false, ""
+				case keyBack:
+					if runes := []rune(p.filter); len(runes) > 0 {
+						p.filter = string(runes[:len(runes)-1])
+					}
+				case keyUp, keyDown, keyLeft, keyRight, keyTab, keyPgUp, keyPgDn:
+				default:
+					p.filter += key
+				}
+				p.selected = 0
+				continue
+			}
+			switch key {
+			case "q":
+				return nil
+			case keyUp, "k":
+				u.move(-1)
+			case keyDown, "j":
+				u.move(1)
+			case keyPgUp:
+				u.move(-(rows / 2))
+			case keyPgDn:
+				u.move(rows / 2)
+			case keyEnter, keyRight, "l":
+				if u.open() != nil {
+					reload()
+				}
+			case keyLeft, keyEsc, keyBack, "h":
+				if p.filter != "" && key == keyEsc {
+					p.filter = ""
+				} else if u.back() {
+					reload()
+				}
+			case keyTab:
+				if u.pages[0].kind == channelsPage {
+					u.pages = []*uiPage{{kind: serversPage}}
+				} else {
+					u.pages = []*uiPage{{kind: channelsPage}}
+				}
+				reload()
+			case "/":
+				u.searching = true
+			case "t":
+				u.showTrace = !u.showTrace
+			case "r":
+				reload()
+			}
+		}
+	}
+}
+
+var uiCmd = &cobra.Command{
+	Use:         "ui",
+	Short:       "Browse channels, servers, subchannels and sockets interactively.",
+	Args:        cobra.NoArgs,
+	RunE:        withRun(uiCommandRunWithError),
+	Annotations: map[string]string{singleTargetAnnotation: ""},
+}
+
+func init() {
+	uiCmd.Flags().DurationVar(&refreshFlag, "refresh", 2*time.Second, "Sets how often the current page is refreshed")
+	rootCmd.AddCommand(uiCmd)
+}
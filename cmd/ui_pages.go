@@ -0,0 +1,296 @@
+// Defines the pages of the ui command, and how each one is loaded
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"grpcdebug/transport"
+
+	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+)
+
+// The kinds of pages, which are also the kinds of the rows leading to them
+const (
+	channelsPage   = "channels"
+	serversPage    = "servers"
+	channelPage    = "channel"
+	subchannelPage = "subchannel"
+	serverPage     = "server"
+	socketPage     = "socket"
+)
+
+// uiRow is a line of the list of a page, leading to the page of an entity
+type uiRow struct {
+	kind    string
+	id      int64
+	columns []string
+}
+
+// uiPage is what the ui shows about the top level lists, or about one entity
+type uiPage struct {
+	kind string
+	id   int64
+	// Where the cursor is, as an index in the filtered rows
+	selected int
+	filter   string
+	details  [][2]string
+	header   []string
+	rows     []uiRow
+	trace    *zpb.ChannelTrace
+	err      error
+	// Whether a load finished, so the page has something to show
+	loaded bool
+}
+
+// title names the page in the title bar
+func (p *uiPage) title() string {
+	switch p.kind {
+	case channelsPage:
+		return "Channels"
+	case serversPage:
+		return "Servers"
+	default:
+		return fmt.Sprintf("%v %v", strings.ToUpper(p.kind[:1])+p.kind[1:], p.id)
+	}
+}
+
+// visibleRows returns the rows matching the search filter
+func (p *uiPage) visibleRows() []uiRow {
+	if p.filter == "" {
+		return p.rows
+	}
+	filter := strings.ToLower(p.filter)
+	var rows []uiRow
+	for _, row := range p.rows {
+		if strings.Contains(strings.ToLower(strings.Join(row.columns, " ")), filter) {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// formatRows aligns the header and the rows into lines
+func formatRows(header []string, rows []uiRow) []string {
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 6, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row.columns, "\t"))
+	}
+	tw.Flush()
+	return strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+}
+
+func callsColumn(started, succeeded, failed int64) string {
+	return fmt.Sprintf("%v/%v/%v", started, succeeded, failed)
+}
+
+func channelRow(channel *zpb.Channel) uiRow {
+	data := channel.GetData()
+	return uiRow{kind: channelPage, id: channel.GetRef().GetChannelId(), columns: []string{
+		"channel",
+		fmt.Sprint(channel.GetRef().GetChannelId()),
+		data.GetTarget(),
+		prettyConnectivityState(data.GetState().GetState()),
+		callsColumn(data.GetCallsStarted(), data.GetCallsSucceeded(), data.GetCallsFailed()),
+	}}
+}
+
+func subchannelRow(subchannel *zpb.Subchannel) uiRow {
+	data := subchannel.GetData()
+	return uiRow{kind: subchannelPage, id: subchannel.GetRef().GetSubchannelId(), columns: []string{
+		"subchannel",
+		fmt.Sprint(subchannel.GetRef().GetSubchannelId()),
+		data.GetTarget(),
+		prettyConnectivityState(data.GetState().GetState()),
+		callsColumn(data.GetCallsStarted(), data.GetCallsSucceeded(), data.GetCallsFailed()),
+	}}
+}
+
+func socketRow(kind string, socket *zpb.Socket) uiRow {
+	data := socket.GetData()
+	// Listen sockets have no remote address
+	addresses := prettyAddress(socket.Local)
+	if socket.Remote != nil {
+		addresses += "->" + prettyAddress(socket.Remote)
+	}
+	return uiRow{kind: socketPage, id: socket.GetRef().GetSocketId(), columns: []string{
+		kind,
+		fmt.Sprint(socket.GetRef().GetSocketId()),
+		addresses,
+		securityModel(socket),
+		callsColumn(data.GetStreamsStarted(), data.GetStreamsSucceeded(), data.GetStreamsFailed()),
+	}}
+}
+
+// errorRow stands for a child that could not be fetched
+func errorRow(kind string, id int64, err error) uiRow {
+	return uiRow{kind: kind, id: id, columns: []string{kind, fmt.Sprint(id), prettyError(err), "", ""}}
+}
+
+var entityHeader = []string{"Kind", "ID", "Target / Address", "State / Security", "Calls / Streams"}
+
+// load fetches what the page shows from client. Failures to fetch children become rows,
+// while a failure to fetch the entity itself is kept in err.
+func (p *uiPage) load(ctx context.Context, client *transport.Client) {
+	f := client.NewFetcher()
+	p.details, p.rows, p.trace, p.err = nil, nil, nil, nil
+	p.header = entityHeader
+	switch p.kind {
+	case channelsPage:
+		channels, err := client.Channels(ctx)
+		p.err = err
+		for _, channel := range channels {
+			p.rows = append(p.rows, channelRow(channel))
+		}
+	case serversPage:
+		p.loadServers(ctx, client, f)
+	case channelPage:
+		channel, err := f.Channel(ctx, p.id)
+		if p.err = err; err != nil {
+			return
+		}
+		data := channel.GetData()
+		p.addEntityDetails(data.GetTarget(), data.GetState().GetState(), data.GetCallsStarted(), data.GetCallsSucceeded(), data.GetCallsFailed())
+		p.details = append(p.details, [2]string{"Created", prettyTime(data.GetTrace().GetCreationTimestamp())})
+		p.addChildren(ctx, f, channel.GetChannelRef(), channel.GetSubchannelRef(), nil)
+		p.trace = data.GetTrace()
+	case subchannelPage:
+		subchannel, err := f.Subchannel(ctx, p.id)
+		if p.err = err; err != nil {
+			return
+		}
+		data := subchannel.GetData()
+		p.addEntityDetails(data.GetTarget(), data.GetState().GetState(), data.GetCallsStarted(), data.GetCallsSucceeded(), data.GetCallsFailed())
+		p.details = append(p.details, [2]string{"Created", prettyTime(data.GetTrace().GetCreationTimestamp())})
+		p.addChildren(ctx, f, subchannel.GetChannelRef(), subchannel.GetSubchannelRef(), subchannel.GetSocketRef())
+		p.trace = data.GetTrace()
+	case serverPage:
+		server, err := client.Server(ctx, p.id)
+		if p.err = err; err != nil {
+			return
+		}
+		data := server.GetData()
+		p.details = [][2]string{
+			{"Calls (Started/Succeeded/Failed)", callsColumn(data.GetCallsStarted(), data.GetCallsSucceeded(), data.GetCallsFailed())},
+			{"Last Call Started", prettyTime(data.GetLastCallStartedTimestamp())},
+		}
+		p.addSockets(ctx, f, "listen", server.GetListenSocket())
+		socketRefs, err := f.ServerSocketRefs(ctx, p.id)
+		if err != nil {
+			p.err = err
+		}
+		p.addSockets(ctx, f, "socket", socketRefs)
+	case socketPage:
+		socket, err := client.Socket(ctx, p.id)
+		if p.err = err; err != nil {
+			return
+		}
+		p.details = socketDetails(socket)
+	}
+}
+
+// show takes what loaded fetched, keeping the cursor and the search filter
+func (p *uiPage) show(loaded *uiPage) {
+	p.details, p.header, p.rows, p.trace, p.err = loaded.details, loaded.header, loaded.rows, loaded.trace, loaded.err
+	p.loaded = true
+}
+
+func (p *uiPage) addEntityDetails(target string, state zpb.ChannelConnectivityState_State, started, succeeded, failed int64) {
+	p.details = [][2]string{
+		{"Target", target},
+		{"State", prettyConnectivityState(state)},
+		{"Calls (Started/Succeeded/Failed)", callsColumn(started, succeeded, failed)},
+	}
+}
+
+func (p *uiPage) addChildren(ctx context.Context, f *transport.Fetcher, channelRefs []*zpb.ChannelRef, subchannelRefs []*zpb.SubchannelRef, socketRefs []*zpb.SocketRef) {
+	channels, errs := f.Channels(ctx, channelRefs)
+	for i, ref := range channelRefs {
+		if errs[i] != nil {
+			p.rows = append(p.rows, errorRow(channelPage, ref.ChannelId, errs[i]))
+			continue
+		}
+		p.rows = append(p.rows, channelRow(channels[i]))
+	}
+	subchannels, errs := f.Subchannels(ctx, subchannelRefs)
+	for i, ref := range subchannelRefs {
+		if errs[i] != nil {
+			p.rows = append(p.rows, errorRow(subchannelPage, ref.SubchannelId, errs[i]))
+			continue
+		}
+		p.rows = append(p.rows, subchannelRow(subchannels[i]))
+	}
+	p.addSockets(ctx, f, "socket", socketRefs)
+}
+
+func (p *uiPage) addSockets(ctx context.Context, f *transport.Fetcher, kind string, socketRefs []*zpb.SocketRef) {
+	sockets, errs := f.Sockets(ctx, socketRefs)
+	for i, ref := range socketRefs {
+		if errs[i] != nil {
+			p.rows = append(p.rows, errorRow(socketPage, ref.SocketId, errs[i]))
+			continue
+		}
+		p.rows = append(p.rows, socketRow(kind, sockets[i]))
+	}
+}
+
+func (p *uiPage) loadServers(ctx context.Context, client *transport.Client, f *transport.Fetcher) {
+	servers, err := client.Servers(ctx)
+	p.err = err
+	p.header = []string{"Kind", "ID", "Listen Addresses", "", "Calls"}
+	var listenSocketRefs []*zpb.SocketRef
+	for _, server := range servers {
+		listenSocketRefs = append(listenSocketRefs, server.ListenSocket...)
+	}
+	f.Sockets(ctx, listenSocketRefs)
+	for _, server := range servers {
+		listenAddresses, _ := listenAddressesOf(ctx, f, server)
+		data := server.GetData()
+		p.rows = append(p.rows, uiRow{kind: serverPage, id: server.Ref.ServerId, columns: []string{
+			"server",
+			fmt.Sprint(server.Ref.ServerId),
+			strings.Join(listenAddresses, ", "),
+			"",
+			callsColumn(data.GetCallsStarted(), data.GetCallsSucceeded(), data.GetCallsFailed()),
+		}})
+	}
+}
+
+// socketDetails summarizes a socket, including its security and TCP state
+func socketDetails(socket *zpb.Socket) [][2]string {
+	data := socket.GetData()
+	details := [][2]string{
+		{"Local", prettyAddress(socket.Local)},
+		{"Remote", prettyAddress(socket.Remote)},
+		{"Streams (Started/Succeeded/Failed)", callsColumn(data.GetStreamsStarted(), data.GetStreamsSucceeded(), data.GetStreamsFailed())},
+		{"Messages (Sent/Received)", fmt.Sprintf("%v/%v", data.GetMessagesSent(), data.GetMessagesReceived())},
+		{"Keep Alives Sent", fmt.Sprint(data.GetKeepAlivesSent())},
+		{"Flow Control Window (Local/Remote)", fmt.Sprintf("%v/%v", prettyFlowControlWindow(data.GetLocalFlowControlWindow()), prettyFlowControlWindow(data.GetRemoteFlowControlWindow()))},
+		{"Last Message Sent", prettyTime(data.GetLastMessageSentTimestamp())},
+		{"Last Message Received", prettyTime(data.GetLastMessageReceivedTimestamp())},
+		{"Security", securityModel(socket)},
+	}
+	if name := socket.GetSecurity().GetTls().GetStandardName(); name != "" {
+		details = append(details, [2]string{"Cipher Suite", name})
+	}
+	for _, option := range data.GetOption() {
+		value, tcpInfo := decodeSocketOption(option)
+		if tcpInfo != nil {
+			details = append(details,
+				[2]string{"TCP State", prettyTcpState(tcpInfo.TcpiState)},
+				[2]string{"RTT (Variance)", fmt.Sprintf("%v (%v)", micros(tcpInfo.TcpiRtt), micros(tcpInfo.TcpiRttvar))},
+				[2]string{"Congestion Window", fmt.Sprintf("%v segments", tcpInfo.TcpiSndCwnd)},
+				[2]string{"Retransmits", fmt.Sprint(tcpInfo.TcpiRetransmits)},
+			)
+			continue
+		}
+		details = append(details, [2]string{option.Name, value})
+	}
+	return details
+}
@@ -0,0 +1,60 @@
+//go:build !windows
+// +build !windows
+
+// Puts the terminal of the ui command in raw mode through stty
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// stty runs stty on the terminal attached to stdin
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// terminal puts the terminal in raw mode and restores it when closed
+type terminal struct {
+	saved string
+	out   *bufio.Writer
+}
+
+func openTerminal() (*terminal, error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("the ui command needs an interactive terminal: %v", err)
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+	t := &terminal{saved: saved, out: bufio.NewWriter(os.Stdout)}
+	t.out.WriteString(enterAltScreen)
+	t.out.Flush()
+	return t, nil
+}
+
+func (t *terminal) Close() {
+	t.out.WriteString(leaveAltScreen)
+	t.out.Flush()
+	stty(t.saved)
+}
+
+// size returns the number of rows and columns, with a fallback if unknown
+func (t *terminal) size() (int, int) {
+	var rows, cols int
+	if out, err := stty("size"); err == nil {
+		fmt.Sscan(out, &rows, &cols)
+	}
+	if rows <= 0 || cols <= 0 {
+		return 24, 80
+	}
+	return rows, cols
+}
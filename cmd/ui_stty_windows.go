@@ -0,0 +1,23 @@
+// Windows has no stty to put the console in raw mode, so the ui command is
+// not available there
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+)
+
+type terminal struct {
+	out *bufio.Writer
+}
+
+func openTerminal() (*terminal, error) {
+	return nil, fmt.Errorf("the ui command is not supported on Windows")
+}
+
+func (t *terminal) Close() {}
+
+func (t *terminal) size() (int, int) {
+	return 24, 80
+}
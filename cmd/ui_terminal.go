@@ -0,0 +1,147 @@
+// Defines the terminal handling of the ui command: key decoding, and
+// full-screen drawing with ANSI sequences. Raw mode is set per platform.
+
+package cmd
+
+import (
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	enterAltScreen = "\x1b[?1049h\x1b[?25l"
+	leaveAltScreen = "\x1b[?25h\x1b[?1049l"
+	cursorHome     = "\x1b[H"
+	clearLineEnd   = "\x1b[K"
+	clearBelow     = "\x1b[J"
+	inverseStyle   = "\x1b[7m"
+	boldStyle      = "\x1b[1m"
+)
+
+// isTerminal reports whether f is a terminal rather than a pipe or a file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// draw replaces the screen with the lines, clipped to the terminal. Styles
+// apply to whole lines, so clipping never cuts an escape sequence.
+func (t *terminal) draw(lines []styledLine) {
+	rows, cols := t.size()
+	t.out.WriteString(cursorHome)
+	for i, line := range lines {
+		if i >= rows {
+			break
+		}
+		text := clip(line.text, cols)
+		if line.style != "" {
+			text = line.style + text + strings.Repeat(" ", cols-utf8.RuneCountInString(text)) + resetStyle
+		}
+		t.out.WriteString(text + clearLineEnd)
+		if i < rows-1 && i < len(lines)-1 {
+			t.out.WriteString("\r\n")
+		}
+	}
+	t.out.WriteString(clearBelow)
+	t.out.Flush()
+}
+
+// styledLine is a line of the screen, with the style of the whole line
+type styledLine struct {
+	text  string
+	style string
+}
+
+// clip cuts s to at most n runes
+func clip(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n])
+}
+
+// The keys the ui reacts to. Printable characters are passed as themselves.
+const (
+	keyUp    = "up"
+	keyDown  = "down"
+	keyLeft  = "left"
+	keyRight = "right"
+	keyEnter = "enter"
+	keyBack  = "backspace"
+	keyEsc   = "esc"
+	keyTab   = "tab"
+	keyCtrlC = "ctrl-c"
+	keyPgUp  = "pgup"
+	keyPgDn  = "pgdn"
+)
+
+// readKeys decodes the keys typed on in and sends them until reading fails
+func readKeys(in io.Reader, keys chan<- string) {
+	buf := make([]byte, 64)
+	for {
+		n, err := in.Read(buf)
+		if err != nil {
+			close(keys)
+			return
+		}
+		for _, key := range decodeKeys(buf[:n]) {
+			keys <- key
+		}
+	}
+}
+
+// decodeKeys splits what one read returned into keys. A lone ESC byte is the
+// escape key, while ESC [ starts an arrow or paging key.
+func decodeKeys(b []byte) []string {
+	var keys []string
+	for len(b) > 0 {
+		switch {
+		case len(b) >= 3 && b[0] == 0x1b && (b[1] == '[' || b[1] == 'O'):
+			switch b[2] {
+			case 'A':
+				keys = append(keys, keyUp)
+			case 'B':
+				keys = append(keys, keyDown)
+			case 'C':
+				keys = append(keys, keyRight)
+			case 'D':
+				keys = append(keys, keyLeft)
+			case '5', '6':
+				if len(b) >= 4 && b[3] == '~' {
+					if b[2] == '5' {
+						keys = append(keys, keyPgUp)
+					} else {
+						keys = append(keys, keyPgDn)
+					}
+					b = b[1:]
+				}
+			}
+			b = b[3:]
+		case b[0] == 0x1b:
+			keys = append(keys, keyEsc)
+			b = b[1:]
+		case b[0] == '\r' || b[0] == '\n':
+			keys = append(keys, keyEnter)
+			b = b[1:]
+		case b[0] == 0x7f || b[0] == 0x08:
+			keys = append(keys, keyBack)
+			b = b[1:]
+		case b[0] == '\t':
+			keys = append(keys, keyTab)
+			b = b[1:]
+		case b[0] == 0x03:
+			keys = append(keys, keyCtrlC)
+			b = b[1:]
+		default:
+			r, size := utf8.DecodeRune(b)
+			if r >= ' ' {
+				keys = append(keys, string(r))
+			}
+			b = b[size:]
+		}
+	}
+	return keys
+}
@@ -0,0 +1,159 @@
+// Defines the --watch mode, which polls a channelz command and redraws it in
+// place with per-second rates
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+)
+
+var watchFlag time.Duration
+
+// Terminal control sequences: move home and clear the screen. The two state
+// styles have the same length, so tabwriter keeps the columns aligned. They
+// are only written to terminals.
+const (
+	clearScreen     = "\x1b[H\x1b[2J"
+	highlightStyle  = "\x1b[1;33m"
+	plainStyle      = "\x1b[0;39m"
+	resetStyle      = "\x1b[0m"
+	unavailableRate = "-"
+)
+
+// sample is what a poll observed about one entity
+type sample struct {
+	counters []int64
+	state    string
+}
+
+// watcher remembers the previous poll to compute rates and transitions
+type watcher struct {
+	previous     map[string]sample
+	previousTime time.Time
+	current      map[string]sample
+	currentTime  time.Time
+	// Whether transitions are highlighted with escape sequences
+	styled bool
+}
+
+func newWatcher(styled bool) *watcher {
+	return &watcher{current: make(map[string]sample), currentTime: time.Now(), styled: styled}
+}
+
+// next starts a new poll, keeping the last one for comparison
+func (t *watcher) next() {
+	t.previous, t.previousTime = t.current, t.currentTime
+	t.current, t.currentTime = make(map[string]sample), time.Now()
+}
+
+// rates records the counters of an entity, and renders how much each one grew
+// per second since the previous poll, separated by slashes. A counter that
+// dropped was reset, as when the entity was recreated with the same ID, so it
+// grew from zero.
+func (t *watcher) rates(key string, counters ...int64) string {
+	s := t.current[key]
+	s.counters = counters
+	t.current[key] = s
+	previous, ok := t.previous[key]
+	elapsed := t.currentTime.Sub(t.previousTime).Seconds()
+	rates := make([]string, len(counters))
+	for i, counter := range counters {
+		if !ok || elapsed <= 0 || len(previous.counters) != len(counters) {
+			rates[i] = unavailableRate
+			continue
+		}
+		grown := counter - previous.counters[i]
+		if grown < 0 {
+			grown = counter
+		}
+		rates[i] = fmt.Sprintf("%.1f", float64(grown)/elapsed)
+	}
+	return strings.Join(rates, "/")
+}
+
+// state records the state of an entity, and highlights it if it changed since
+// the previous poll
+func (t *watcher) state(key, state string) string {
+	s := t.current[key]
+	s.state = state
+	t.current[key] = s
+	if previous, ok := t.previous[key]; ok && previous.state != state {
+		if !t.styled {
+			return fmt.Sprintf("%v -> %v", previous.state, state)
+		}
+		return fmt.Sprintf("%v%v -> %v%v", highlightStyle, previous.state, state, resetStyle)
+	}
+	if !t.styled {
+		return state
+	}
+	return plainStyle + state + resetStyle
+}
+
+// watchedState renders a state, highlighting transitions when watching
+func (r *commandRun) watchedState(key, state string) string {
+	if r.watching == nil {
+		return state
+	}
+	return r.watching.state(key, state)
+}
+
+// socketRates records the counters of a socket, and renders the per-second
+// rates of its streams and messages
+func (r *commandRun) socketRates(socket *zpb.Socket) (string, string) {
+	key := fmt.Sprintf("socket/%v", socket.Ref.SocketId)
+	data := socket.Data
+	return r.watching.rates(key+"/streams", data.StreamsStarted, data.StreamsSucceeded, data.StreamsFailed),
+		r.watching.rates(key+"/messages", data.MessagesSent, data.MessagesReceived)
+}
+
+// callRates records the call counters of an entity, and renders their
+// per-second rates
+func (r *commandRun) callRates(key string, started, succeeded, failed int64) string {
+	return r.watching.rates(key+"/calls", started, succeeded, failed)
+}
+
+// runWatched runs the command once, or with --watch, every interval until
+// interrupted. Errors of a poll are shown on screen instead of stopping it.
+func (r *commandRun) runWatched(cmd *cobra.Command, run func() error) error {
+	if watchFlag <= 0 {
+		return run()
+	}
+	if jsonOutputFlag {
+		return fmt.Errorf("--watch cannot be combined with --json")
+	}
+	ctx := cmd.Context()
+	// Redirected output gets the polls one after the other, without escapes
+	f, ok := r.out.(*os.File)
+	styled := ok && isTerminal(f)
+	r.watching = newWatcher(styled)
+	ticker := time.NewTicker(watchFlag)
+	defer ticker.Stop()
+	for polls := 0; ; polls++ {
+		if styled {
+			fmt.Fprint(r.out, clearScreen)
+		} else if polls > 0 {
+			fmt.Fprintln(r.out)
+		}
+		fmt.Fprintf(r.out, "Every %v: %v    %v\n\n", watchFlag, cmd.CommandPath(), time.Now().Format(time.RFC3339))
+		if err := run(); err != nil && ctx.Err() == nil {
+			fmt.Fprintf(r.out, "\n%v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		r.watching.next()
+	}
+}
+
+// addWatchFlag registers --watch on a command that supports it
+func addWatchFlag(cmd *cobra.Command) {
+	cmd.Flags().DurationVar(&watchFlag, "watch", 0, "Polls every interval and redraws in place, with per-second rates and state transitions")
+}
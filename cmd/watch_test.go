@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWatcherRates(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		name     string
+		previous []int64
+		current  []int64
+		elapsed  time.Duration
+		want     string
+	}{
+		{name: "first poll", current: []int64{5, 3}, elapsed: 2 * time.Second, want: "-/-"},
+		{name: "growth", previous: []int64{5, 3}, current: []int64{9, 3}, elapsed: 2 * time.Second, want: "2.0/0.0"},
+		{name: "fractional", previous: []int64{0}, current: []int64{1}, elapsed: 4 * time.Second, want: "0.2"},
+		{name: "reset counter", previous: []int64{100, 3}, current: []int64{4, 5}, elapsed: 2 * time.Second, want: "2.0/1.0"},
+		{name: "different counters", previous: []int64{1}, current: []int64{1, 2}, elapsed: time.Second, want: "-/-"},
+		{name: "no time elapsed", previous: []int64{1}, current: []int64{2}, want: "-"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			watcher := newWatcher(false)
+			watcher.currentTime = start
+			if test.previous != nil {
+				watcher.rates("key", test.previous...)
+			}
+			watcher.next()
+			watcher.currentTime = start.Add(test.elapsed)
+			if got := watcher.rates("key", test.current...); got != test.want {
+				t.Errorf("rates() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWatcherState(t *testing.T) {
+	for _, test := range []struct {
+		styled bool
+		want   []string
+	}{
+		{styled: false, want: []string{"IDLE", "IDLE", "IDLE -> READY"}},
+		{styled: true, want: []string{plainStyle + "IDLE" + resetStyle, plainStyle + "IDLE" + resetStyle, highlightStyle + "IDLE -> READY" + resetStyle}},
+	} {
+		watcher := newWatcher(test.styled)
+		for i, state := range []string{"IDLE", "IDLE", "READY"} {
+			if got := watcher.state("key", state); got != test.want[i] {
+				t.Errorf("styled: %v, poll %v: state() = %q, want %q", test.styled, i, got, test.want[i])
+			}
+			watcher.next()
+		}
+	}
+}
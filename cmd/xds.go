@@ -2,22 +2,17 @@ package cmd
 
 import (
 	"fmt"
-	"grpcdebug/transport"
 	"strings"
 
-	adminpb "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
-	clusterpb "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
-	endpointpb "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
-	routepb "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"grpcdebug/pkg/grpcdebug"
+
 	csdspb "github.com/envoyproxy/go-control-plane/envoy/service/status/v3"
-	"github.com/golang/protobuf/ptypes"
-	timestamppb "github.com/golang/protobuf/ptypes/timestamp"
 	"github.com/spf13/cobra"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 )
 
-func printJson(m proto.Message) error {
+func (r *commandRun) printJson(m proto.Message) error {
 	var option protojson.MarshalOptions
 	option.Multiline = true
 	option.Indent = "  "
@@ -27,35 +22,41 @@ func printJson(m proto.Message) error {
 	if err != nil {
 		return err
 	}
-	fmt.Println(string(jsonbytes))
+	fmt.Fprintln(r.out, string(jsonbytes))
 	return nil
 }
 
-func xdsConfigCommandRunWithError(cmd *cobra.Command, args []string) error {
-	clientStatus := transport.FetchClientStatus()
+func xdsConfigCommandRunWithError(r *commandRun, cmd *cobra.Command, args []string) error {
+	clientStatus, err := r.client.FetchClientStatus(cmd.Context())
+	if err != nil {
+		return err
+	}
 	if len(args) == 0 {
-		return printJson(clientStatus)
+		return r.printJson(clientStatus)
 	}
 	// Filter the CSDS output
+	if len(clientStatus.Config) == 0 {
+		return fmt.Errorf("The CSDS response has no config")
+	}
 	var demand string
 	demand = strings.ToLower(args[0])
 	for _, xds_config := range clientStatus.Config[0].XdsConfig {
 		switch x := xds_config.PerXdsConfig.(type) {
 		case *csdspb.PerXdsConfig_ListenerConfig:
 			if demand == "lds" {
-				return printJson(xds_config.GetListenerConfig())
+				return r.printJson(xds_config.GetListenerConfig())
 			}
 		case *csdspb.PerXdsConfig_RouteConfig:
 			if demand == "rds" {
-				return printJson(xds_config.GetRouteConfig())
+				return r.printJson(xds_config.GetRouteConfig())
 			}
 		case *csdspb.PerXdsConfig_ClusterConfig:
 			if demand == "cds" {
-				return printJson(xds_config.GetClusterConfig())
+				return r.printJson(xds_config.GetClusterConfig())
 			}
 		case *csdspb.PerXdsConfig_EndpointConfig:
 			if demand == "eds" {
-				return printJson(xds_config.GetEndpointConfig())
+				return r.printJson(xds_config.GetEndpointConfig())
 			}
 		default:
 			return fmt.Errorf("Unexpected type %T", x)
@@ -67,116 +68,38 @@ func xdsConfigCommandRunWithError(cmd *cobra.Command, args []string) error {
 var xdsConfigCmd = &cobra.Command{
 	Use:   "config",
 	Short: "Dump the operating xDS configs.",
-	RunE:  xdsConfigCommandRunWithError,
+	RunE:  withRun(xdsConfigCommandRunWithError),
 	Args:  cobra.MaximumNArgs(1),
 }
 
-type xdsResourceStatusEntry struct {
-	Name        string
-	Status      adminpb.ClientResourceStatus
-	Version     string
-	Type        string
-	LastUpdated *timestamppb.Timestamp
-}
-
-func prettyClientResourceStatus(s adminpb.ClientResourceStatus) string {
-	return adminpb.ClientResourceStatus_name[int32(s)]
-}
-
-func printStatusEntry(entry *xdsResourceStatusEntry) {
+func (r *commandRun) printStatusEntry(entry *grpcdebug.XdsResourceStatus) {
 	fmt.Fprintf(
-		w, "%v\t%v\t%v\t%v\t%v\t\n",
+		r.w, "%v\t%v\t%v\t%v\t%v\t\n",
 		entry.Name,
-		prettyClientResourceStatus(entry.Status),
+		entry.Status,
 		entry.Version,
 		entry.Type,
-		prettyTime(entry.LastUpdated),
+		prettyTimeValue(entry.LastUpdated),
 	)
 }
 
-func xdsStatusCommandRunWithError(cmd *cobra.Command, args []string) error {
-	clientStatus := transport.FetchClientStatus()
-
-	fmt.Fprintln(w, "Name\tStatus\tVersion\tType\tLastUpdated")
-	config := clientStatus.Config[0]
-	for _, xdsConfig := range config.XdsConfig {
-		switch x := xdsConfig.PerXdsConfig.(type) {
-		case *csdspb.PerXdsConfig_ListenerConfig:
-			for _, dynamicListener := range xdsConfig.GetListenerConfig().DynamicListeners {
-				var entry = xdsResourceStatusEntry{
-					Name:   dynamicListener.Name,
-					Status: dynamicListener.ClientStatus,
-				}
-				if state := dynamicListener.GetActiveState(); state != nil {
-					entry.Version = state.VersionInfo
-					entry.Type = state.Listener.TypeUrl
-					entry.LastUpdated = state.LastUpdated
-				}
-				printStatusEntry(&entry)
-			}
-		case *csdspb.PerXdsConfig_RouteConfig:
-			for _, dynamicRouteConfig := range xdsConfig.GetRouteConfig().DynamicRouteConfigs {
-				var entry = xdsResourceStatusEntry{
-					Status:      dynamicRouteConfig.ClientStatus,
-					Version:     dynamicRouteConfig.VersionInfo,
-					Type:        dynamicRouteConfig.RouteConfig.TypeUrl,
-					LastUpdated: dynamicRouteConfig.LastUpdated,
-				}
-				if packed := dynamicRouteConfig.GetRouteConfig(); packed != nil {
-					var routeConfig routepb.RouteConfiguration
-					if err := ptypes.UnmarshalAny(packed, &routeConfig); err != nil {
-						return err
-					}
-					entry.Name = routeConfig.Name
-				}
-				printStatusEntry(&entry)
-			}
-		case *csdspb.PerXdsConfig_ClusterConfig:
-			for _, dynamicCluster := range xdsConfig.GetClusterConfig().DynamicActiveClusters {
-				var entry = xdsResourceStatusEntry{
-					Status:      dynamicCluster.ClientStatus,
-					Version:     dynamicCluster.VersionInfo,
-					Type:        dynamicCluster.Cluster.TypeUrl,
-					LastUpdated: dynamicCluster.LastUpdated,
-				}
-				if packed := dynamicCluster.GetCluster(); packed != nil {
-					var cluster clusterpb.Cluster
-					if err := ptypes.UnmarshalAny(packed, &cluster); err != nil {
-						return err
-					}
-					entry.Name = cluster.Name
-				}
-				printStatusEntry(&entry)
-			}
-		case *csdspb.PerXdsConfig_EndpointConfig:
-			for _, dynamicEndpoint := range xdsConfig.GetEndpointConfig().GetDynamicEndpointConfigs() {
-				var entry = xdsResourceStatusEntry{
-					Status:      dynamicEndpoint.ClientStatus,
-					Version:     dynamicEndpoint.VersionInfo,
-					Type:        dynamicEndpoint.EndpointConfig.TypeUrl,
-					LastUpdated: dynamicEndpoint.LastUpdated,
-				}
-				if packed := dynamicEndpoint.GetEndpointConfig(); packed != nil {
-					var endpoint endpointpb.ClusterLoadAssignment
-					if err := ptypes.UnmarshalAny(packed, &endpoint); err != nil {
-						return err
-					}
-					entry.Name = endpoint.ClusterName
-				}
-				printStatusEntry(&entry)
-			}
-		default:
-			return fmt.Errorf("Unexpected type %T", x)
-		}
+func xdsStatusCommandRunWithError(r *commandRun, cmd *cobra.Command, args []string) error {
+	entries, err := grpcdebug.New(r.client).XdsResourceStatuses(cmd.Context())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(r.w, "Name\tStatus\tVersion\tType\tLastUpdated")
+	for i := range entries {
+		r.printStatusEntry(&entries[i])
 	}
-	w.Flush()
+	r.w.Flush()
 	return nil
 }
 
 var xdsStatusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Print the config synchronization status.",
-	RunE:  xdsStatusCommandRunWithError,
+	RunE:  withRun(xdsStatusCommandRunWithError),
 }
 
 var xdsCmd = &cobra.Command{
@@ -1,12 +1,13 @@
 module grpcdebug
 
-go 1.15
+go 1.16
 
 require (
 	github.com/dustin/go-humanize v1.0.0
 	github.com/envoyproxy/go-control-plane v0.9.9-0.20210208192213-66ad1e49efae
 	github.com/golang/protobuf v1.4.2
 	github.com/spf13/cobra v1.1.1
+	golang.org/x/oauth2 v0.0.0-20190604053449-0f29369cfe45
 	google.golang.org/grpc v1.27.0
 	google.golang.org/protobuf v1.23.0
 )
@@ -35,6 +35,7 @@ var (
 	servingPortFlag     = flag.Int("serving", 10001, "the serving port")
 	adminPortFlag       = flag.Int("admin", 50051, "the admin port")
 	secureAdminPortFlag = flag.Int("secure_admin", 50052, "the secure admin port")
+	udsAdminFlag        = flag.String("uds_admin", "", "the Unix domain socket path of an extra insecure admin server, \"@name\" for an abstract socket")
 	healthFlag          = flag.Bool("health", true, "the health checking status")
 	qpsFlag             = flag.Int("qps", 10, "The size of the generated load against itself")
 	abortPercentageFlag = flag.Int("abort", 10, "The percentage of failed RPCs")
@@ -91,6 +92,7 @@ func setupAdminServer(s *grpc.Server) {
 }
 
 func main() {
+	flag.Parse()
 	// Creates the primary server
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *servingPortFlag))
 	if err != nil {
@@ -125,6 +127,18 @@ func main() {
 	setupAdminServer(secureAdminServer)
 	go secureAdminServer.Serve(secureListener)
 	fmt.Printf("Serving Secure Admin Services on :%d\n", *secureAdminPortFlag)
+	// Creates the admin server on a Unix domain socket, if requested
+	if *udsAdminFlag != "" {
+		udsListener, err := net.Listen("unix", *udsAdminFlag)
+		if err != nil {
+			panic(err)
+		}
+		defer udsListener.Close()
+		udsAdminServer := grpc.NewServer()
+		setupAdminServer(udsAdminServer)
+		go udsAdminServer.Serve(udsListener)
+		fmt.Printf("Serving Insecure Admin Services on unix:%v\n", *udsAdminFlag)
+	}
 	// Creates a client to hydrate the primary server
 	creds, err := credentials.NewClientTLSFromFile(testdata.Path("ca.pem"), "*.test.youtube.com")
 	if err != nil {
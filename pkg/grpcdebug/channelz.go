@@ -0,0 +1,353 @@
+package grpcdebug
+
+import (
+	"context"
+	"time"
+
+	"grpcdebug/transport"
+
+	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+)
+
+// CallCounts counts the calls of a channel, subchannel or server
+type CallCounts struct {
+	Started   int64
+	Succeeded int64
+	Failed    int64
+}
+
+// TraceEvent is an event of the trace of a channel or subchannel
+type TraceEvent struct {
+	Severity    zpb.ChannelTraceEvent_Severity
+	Time        time.Time
+	Description string
+	// The ID of the channel or subchannel the event is about, or 0
+	ChildChannelID    int64
+	ChildSubchannelID int64
+}
+
+// Channel is a channel with its child channels and subchannels resolved,
+// recursively
+type Channel struct {
+	ID                int64
+	Name              string
+	Target            string
+	State             zpb.ChannelConnectivityState_State
+	Calls             CallCounts
+	CreatedAt         time.Time
+	LastCallStartedAt time.Time
+	Trace             []TraceEvent
+	Channels          []*Channel
+	Subchannels       []*Subchannel
+	// Set when the channel is one of its own ancestors, and so not expanded
+	Cycle bool `json:",omitempty"`
+	// The error fetching the channel; only ID is set along with it
+	Err error `json:"-"`
+	// The channelz message the view was built from
+	Raw *zpb.Channel `json:"-"`
+}
+
+// Subchannel is a subchannel with its child channels, subchannels and
+// sockets resolved, recursively
+type Subchannel struct {
+	ID                int64
+	Name              string
+	Target            string
+	State             zpb.ChannelConnectivityState_State
+	Calls             CallCounts
+	CreatedAt         time.Time
+	LastCallStartedAt time.Time
+	Trace             []TraceEvent
+	Channels          []*Channel
+	Subchannels       []*Subchannel
+	Sockets           []*Socket
+	// Set when the subchannel is one of its own ancestors, and so not expanded
+	Cycle bool `json:",omitempty"`
+	// The error fetching the subchannel; only ID is set along with it
+	Err error `json:"-"`
+	// The channelz message the view was built from
+	Raw *zpb.Subchannel `json:"-"`
+}
+
+// Socket is a connection of a subchannel, or of a server
+type Socket struct {
+	ID               int64
+	Name             string
+	Local            *zpb.Address
+	Remote           *zpb.Address
+	RemoteName       string
+	Security         *zpb.Security
+	StreamsStarted   int64
+	StreamsSucceeded int64
+	StreamsFailed    int64
+	MessagesSent     int64
+	MessagesReceived int64
+	// The flow control windows, if the transport reports them
+	LocalFlowControlWindow  *int64 `json:",omitempty"`
+	RemoteFlowControlWindow *int64 `json:",omitempty"`
+	// The error fetching the socket; only ID is set along with it
+	Err error `json:"-"`
+	// The channelz message the view was built from
+	Raw *zpb.Socket `json:"-"`
+}
+
+// Server is a server with its listen and connected sockets resolved
+type Server struct {
+	ID                int64
+	Name              string
+	Calls             CallCounts
+	LastCallStartedAt time.Time
+	ListenSockets     []*Socket
+	Sockets           []*Socket
+	// The channelz message the view was built from
+	Raw *zpb.Server `json:"-"`
+}
+
+func newTrace(trace *zpb.ChannelTrace) []TraceEvent {
+	var events []TraceEvent
+	for _, event := range trace.GetEvents() {
+		events = append(events, TraceEvent{
+			Severity:          event.Severity,
+			Time:              transport.TimeOf(event.Timestamp),
+			Description:       event.Description,
+			ChildChannelID:    event.GetChannelRef().GetChannelId(),
+			ChildSubchannelID: event.GetSubchannelRef().GetSubchannelId(),
+		})
+	}
+	return events
+}
+
+func newCallCounts(data *zpb.ChannelData) CallCounts {
+	return CallCounts{
+		Started:   data.GetCallsStarted(),
+		Succeeded: data.GetCallsSucceeded(),
+		Failed:    data.GetCallsFailed(),
+	}
+}
+
+func newChannel(channel *zpb.Channel) *Channel {
+	data := channel.GetData()
+	return &Channel{
+		ID:                channel.GetRef().GetChannelId(),
+		Name:              channel.GetRef().GetName(),
+		Target:            data.GetTarget(),
+		State:             data.GetState().GetState(),
+		Calls:             newCallCounts(data),
+		CreatedAt:         transport.TimeOf(data.GetTrace().GetCreationTimestamp()),
+		LastCallStartedAt: transport.TimeOf(data.GetLastCallStartedTimestamp()),
+		Trace:             newTrace(data.GetTrace()),
+		Raw:               channel,
+	}
+}
+
+func newSubchannel(subchannel *zpb.Subchannel) *Subchannel {
+	data := subchannel.GetData()
+	return &Subchannel{
+		ID:                subchannel.GetRef().GetSubchannelId(),
+		Name:              subchannel.GetRef().GetName(),
+		Target:            data.GetTarget(),
+		State:             data.GetState().GetState(),
+		Calls:             newCallCounts(data),
+		CreatedAt:         transport.TimeOf(data.GetTrace().GetCreationTimestamp()),
+		LastCallStartedAt: transport.TimeOf(data.GetLastCallStartedTimestamp()),
+		Trace:             newTrace(data.GetTrace()),
+		Raw:               subchannel,
+	}
+}
+
+func newSocket(socket *zpb.Socket) *Socket {
+	data := socket.GetData()
+	view := &Socket{
+		ID:               socket.GetRef().GetSocketId(),
+		Name:             socket.GetRef().GetName(),
+		Local:            socket.GetLocal(),
+		Remote:           socket.GetRemote(),
+		RemoteName:       socket.GetRemoteName(),
+		Security:         socket.GetSecurity(),
+		StreamsStarted:   data.GetStreamsStarted(),
+		StreamsSucceeded: data.GetStreamsSucceeded(),
+		StreamsFailed:    data.GetStreamsFailed(),
+		MessagesSent:     data.GetMessagesSent(),
+		MessagesReceived: data.GetMessagesReceived(),
+		Raw:              socket,
+	}
+	if window := data.GetLocalFlowControlWindow(); window != nil {
+		view.LocalFlowControlWindow = &window.Value
+	}
+	if window := data.GetRemoteFlowControlWindow(); window != nil {
+		view.RemoteFlowControlWindow = &window.Value
+	}
+	return view
+}
+
+func newServer(server *zpb.Server) *Server {
+	data := server.GetData()
+	return &Server{
+		ID:                server.GetRef().GetServerId(),
+		Name:              server.GetRef().GetName(),
+		Calls:             CallCounts{data.GetCallsStarted(), data.GetCallsSucceeded(), data.GetCallsFailed()},
+		LastCallStartedAt: transport.TimeOf(data.GetLastCallStartedTimestamp()),
+		Raw:               server,
+	}
+}
+
+// channelOf builds the view of a channel node of a tree
+func channelOf(node *transport.TreeNode) *Channel {
+	if node.Err != nil {
+		return &Channel{ID: node.ID, Err: node.Err}
+	}
+	view := newChannel(node.Channel)
+	view.Cycle = node.Cycle
+	for _, child := range node.Children {
+		switch child.Kind {
+		case transport.ChannelNode:
+			view.Channels = append(view.Channels, channelOf(child))
+		case transport.SubchannelNode:
+			view.Subchannels = append(view.Subchannels, subchannelOf(child))
+		}
+	}
+	return view
+}
+
+// subchannelOf builds the view of a subchannel node of a tree
+func subchannelOf(node *transport.TreeNode) *Subchannel {
+	if node.Err != nil {
+		return &Subchannel{ID: node.ID, Err: node.Err}
+	}
+	view := newSubchannel(node.Subchannel)
+	view.Cycle = node.Cycle
+	for _, child := range node.Children {
+		switch child.Kind {
+		case transport.ChannelNode:
+			view.Channels = append(view.Channels, channelOf(child))
+		case transport.SubchannelNode:
+			view.Subchannels = append(view.Subchannels, subchannelOf(child))
+		case transport.SocketNode:
+			if child.Err != nil {
+				view.Sockets = append(view.Sockets, &Socket{ID: child.ID, Err: child.Err})
+			} else {
+				view.Sockets = append(view.Sockets, newSocket(child.Socket))
+			}
+		}
+	}
+	return view
+}
+
+// Channels returns the top channels, each with its nested channels,
+// subchannels and sockets resolved.
+func (d *Debugger) Channels(ctx context.Context) ([]*Channel, error) {
+	channels, err := d.client.Channels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	trees, errs := d.client.NewFetcher().ChannelTrees(ctx, channels)
+	views := make([]*Channel, len(trees))
+	for i, tree := range trees {
+		views[i] = channelOf(tree)
+	}
+	return views, firstOf(errs)
+}
+
+// Channel returns the queried channel, with its nested channels, subchannels
+// and sockets resolved.
+func (d *Debugger) Channel(ctx context.Context, channelID int64) (*Channel, error) {
+	f := d.client.NewFetcher()
+	channel, err := f.Channel(ctx, channelID)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := f.ChannelTree(ctx, channel)
+	return channelOf(tree), err
+}
+
+// ResolveChannel builds the view of an already fetched channel, fetching its
+// nested channels, subchannels and sockets.
+func (d *Debugger) ResolveChannel(ctx context.Context, channel *zpb.Channel) (*Channel, error) {
+	tree, err := d.client.NewFetcher().ChannelTree(ctx, channel)
+	return channelOf(tree), err
+}
+
+// Subchannel returns the queried subchannel, with its nested channels,
+// subchannels and sockets resolved. If the subchannel itself cannot be
+// fetched, the view only has ID and Err set.
+func (d *Debugger) Subchannel(ctx context.Context, subchannelID int64) (*Subchannel, error) {
+	tree, err := d.client.NewFetcher().SubchannelTree(ctx, subchannelID)
+	return subchannelOf(tree), err
+}
+
+// Socket returns the queried socket. If it cannot be fetched, the view only
+// has ID and Err set.
+func (d *Debugger) Socket(ctx context.Context, socketID int64) (*Socket, error) {
+	socket, err := d.client.Socket(ctx, socketID)
+	if err != nil {
+		return &Socket{ID: socketID, Err: err}, err
+	}
+	return newSocket(socket), nil
+}
+
+func resolveSockets(ctx context.Context, f *transport.Fetcher, socketRefs []*zpb.SocketRef) ([]*Socket, error) {
+	sockets, errs := f.Sockets(ctx, socketRefs)
+	views := make([]*Socket, len(sockets))
+	for i, socket := range sockets {
+		if errs[i] != nil {
+			views[i] = &Socket{ID: socketRefs[i].SocketId, Err: errs[i]}
+			continue
+		}
+		views[i] = newSocket(socket)
+	}
+	return views, firstOf(errs)
+}
+
+// Servers returns the servers, each with its listen and connected sockets
+// resolved.
+func (d *Debugger) Servers(ctx context.Context) ([]*Server, error) {
+	servers, err := d.client.Servers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f := d.client.NewFetcher()
+	socketRefs, refErrs := f.ServersSocketRefs(ctx, servers)
+	views := make([]*Server, len(servers))
+	errs := make([]error, len(servers))
+	for i, server := range servers {
+		views[i], errs[i] = resolveServer(ctx, f, server, socketRefs[i], refErrs[i])
+	}
+	return views, firstOf(errs)
+}
+
+// Server returns the queried server, with its sockets resolved.
+func (d *Debugger) Server(ctx context.Context, serverID int64) (*Server, error) {
+	server, err := d.client.Server(ctx, serverID)
+	if err != nil {
+		return nil, err
+	}
+	return d.ResolveServer(ctx, server)
+}
+
+// ResolveServer builds the view of an already fetched server, fetching its
+// listen and connected sockets.
+func (d *Debugger) ResolveServer(ctx context.Context, server *zpb.Server) (*Server, error) {
+	f := d.client.NewFetcher()
+	socketRefs, err := f.ServerSocketRefs(ctx, server.GetRef().GetServerId())
+	return resolveServer(ctx, f, server, socketRefs, err)
+}
+
+// resolveServer fetches the listen sockets and the listed connected sockets
+// of a server. refErr is the error listing the latter.
+func resolveServer(ctx context.Context, f *transport.Fetcher, server *zpb.Server, socketRefs []*zpb.SocketRef, refErr error) (*Server, error) {
+	view := newServer(server)
+	listenSockets, listenErr := resolveSockets(ctx, f, server.GetListenSocket())
+	sockets, socketErr := resolveSockets(ctx, f, socketRefs)
+	view.ListenSockets, view.Sockets = listenSockets, sockets
+	return view, firstOf([]error{listenErr, refErr, socketErr})
+}
+
+// firstOf returns the first non-nil error
+func firstOf(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
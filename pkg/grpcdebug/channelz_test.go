@@ -0,0 +1,203 @@
+package grpcdebug
+
+import (
+	"context"
+	"testing"
+
+	"grpcdebug/transport"
+
+	"google.golang.org/grpc"
+	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	wrapperspb "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// fakeChannelz serves channelz entities from memory, in a single page
+type fakeChannelz struct {
+	zpb.ChannelzClient
+	topChannels   []int64
+	channels      map[int64]*zpb.Channel
+	subchannels   map[int64]*zpb.Subchannel
+	sockets       map[int64]*zpb.Socket
+	servers       map[int64]*zpb.Server
+	serverSockets map[int64][]*zpb.SocketRef
+}
+
+func (f *fakeChannelz) GetTopChannels(ctx context.Context, in *zpb.GetTopChannelsRequest, opts ...grpc.CallOption) (*zpb.GetTopChannelsResponse, error) {
+	resp := &zpb.GetTopChannelsResponse{End: true}
+	for _, id := range f.topChannels {
+		resp.Channel = append(resp.Channel, f.channels[id])
+	}
+	return resp, nil
+}
+
+func (f *fakeChannelz) GetChannel(ctx context.Context, in *zpb.GetChannelRequest, opts ...grpc.CallOption) (*zpb.GetChannelResponse, error) {
+	if channel, ok := f.channels[in.ChannelId]; ok {
+		return &zpb.GetChannelResponse{Channel: channel}, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "no channel %v", in.ChannelId)
+}
+
+func (f *fakeChannelz) GetSubchannel(ctx context.Context, in *zpb.GetSubchannelRequest, opts ...grpc.CallOption) (*zpb.GetSubchannelResponse, error) {
+	if subchannel, ok := f.subchannels[in.SubchannelId]; ok {
+		return &zpb.GetSubchannelResponse{Subchannel: subchannel}, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "no subchannel %v", in.SubchannelId)
+}
+
+func (f *fakeChannelz) GetSocket(ctx context.Context, in *zpb.GetSocketRequest, opts ...grpc.CallOption) (*zpb.GetSocketResponse, error) {
+	if socket, ok := f.sockets[in.SocketId]; ok {
+		return &zpb.GetSocketResponse{Socket: socket}, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "no socket %v", in.SocketId)
+}
+
+func (f *fakeChannelz) GetServers(ctx context.Context, in *zpb.GetServersRequest, opts ...grpc.CallOption) (*zpb.GetServersResponse, error) {
+	resp := &zpb.GetServersResponse{End: true}
+	for _, server := range f.servers {
+		resp.Server = append(resp.Server, server)
+	}
+	return resp, nil
+}
+
+func (f *fakeChannelz) GetServer(ctx context.Context, in *zpb.GetServerRequest, opts ...grpc.CallOption) (*zpb.GetServerResponse, error) {
+	if server, ok := f.servers[in.ServerId]; ok {
+		return &zpb.GetServerResponse{Server: server}, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "no server %v", in.ServerId)
+}
+
+func (f *fakeChannelz) GetServerSockets(ctx context.Context, in *zpb.GetServerSocketsRequest, opts ...grpc.CallOption) (*zpb.GetServerSocketsResponse, error) {
+	return &zpb.GetServerSocketsResponse{SocketRef: f.serverSockets[in.ServerId], End: true}, nil
+}
+
+// newFakeChannelz builds a top channel 1 with a child channel 2 and a
+// subchannel 3, which has socket 4 and a missing socket 5, and loops back to
+// channel 1. Server 6 listens on socket 7 and is connected through socket 8.
+func newFakeChannelz() *fakeChannelz {
+	data := func(target string, state zpb.ChannelConnectivityState_State) *zpb.ChannelData {
+		return &zpb.ChannelData{Target: target, State: &zpb.ChannelConnectivityState{State: state}, CallsStarted: 3, CallsSucceeded: 2, CallsFailed: 1}
+	}
+	return &fakeChannelz{
+		topChannels: []int64{1},
+		channels: map[int64]*zpb.Channel{
+			1: {
+				Ref:           &zpb.ChannelRef{ChannelId: 1},
+				Data:          data("xds:///service", zpb.ChannelConnectivityState_READY),
+				ChannelRef:    []*zpb.ChannelRef{{ChannelId: 2}},
+				SubchannelRef: []*zpb.SubchannelRef{{SubchannelId: 3}},
+			},
+			2: {Ref: &zpb.ChannelRef{ChannelId: 2}, Data: data("control-plane:443", zpb.ChannelConnectivityState_CONNECTING)},
+		},
+		subchannels: map[int64]*zpb.Subchannel{
+			3: {
+				Ref:        &zpb.SubchannelRef{SubchannelId: 3},
+				Data:       data("10.0.0.1:8080", zpb.ChannelConnectivityState_READY),
+				ChannelRef: []*zpb.ChannelRef{{ChannelId: 1}},
+				SocketRef:  []*zpb.SocketRef{{SocketId: 4}, {SocketId: 5}},
+			},
+		},
+		sockets: map[int64]*zpb.Socket{
+			4: {
+				Ref:  &zpb.SocketRef{SocketId: 4},
+				Data: &zpb.SocketData{StreamsStarted: 2, LocalFlowControlWindow: &wrapperspb.Int64Value{Value: 65535}},
+			},
+			7: {Ref: &zpb.SocketRef{SocketId: 7}, Data: &zpb.SocketData{}},
+			8: {Ref: &zpb.SocketRef{SocketId: 8}, Data: &zpb.SocketData{MessagesReceived: 5}},
+		},
+		servers: map[int64]*zpb.Server{
+			6: {
+				Ref:          &zpb.ServerRef{ServerId: 6},
+				Data:         &zpb.ServerData{CallsStarted: 10, CallsSucceeded: 9},
+				ListenSocket: []*zpb.SocketRef{{SocketId: 7}},
+			},
+		},
+		serverSockets: map[int64][]*zpb.SocketRef{6: {{SocketId: 8}}},
+	}
+}
+
+func TestChannels(t *testing.T) {
+	debugger := New(transport.NewClientFromStubs(newFakeChannelz(), nil, nil))
+	channels, err := debugger.Channels(context.Background())
+	// The missing socket is kept, and reported
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Channels() error = %v, want NotFound", err)
+	}
+	if len(channels) != 1 {
+		t.Fatalf("Channels() = %v channels, want 1", len(channels))
+	}
+	channel := channels[0]
+	if channel.ID != 1 || channel.Target != "xds:///service" || channel.State != zpb.ChannelConnectivityState_READY || channel.Calls != (CallCounts{3, 2, 1}) {
+		t.Errorf("channel = %+v, want channel 1", channel)
+	}
+	if len(channel.Channels) != 1 || channel.Channels[0].Target != "control-plane:443" {
+		t.Fatalf("child channels = %+v, want channel 2", channel.Channels)
+	}
+	if len(channel.Subchannels) != 1 {
+		t.Fatalf("subchannels = %+v, want subchannel 3", channel.Subchannels)
+	}
+	subchannel := channel.Subchannels[0]
+	if len(subchannel.Channels) != 1 || !subchannel.Channels[0].Cycle || subchannel.Channels[0].Subchannels != nil {
+		t.Errorf("subchannel channels = %+v, want channel 1 as an unexpanded cycle", subchannel.Channels)
+	}
+	if len(subchannel.Sockets) != 2 {
+		t.Fatalf("sockets = %+v, want sockets 4 and 5", subchannel.Sockets)
+	}
+	if socket := subchannel.Sockets[0]; socket.StreamsStarted != 2 || socket.LocalFlowControlWindow == nil || *socket.LocalFlowControlWindow != 65535 || socket.RemoteFlowControlWindow != nil {
+		t.Errorf("socket 4 = %+v, want 2 streams and only a local window", socket)
+	}
+	if socket := subchannel.Sockets[1]; socket.ID != 5 || status.Code(socket.Err) != codes.NotFound || socket.Raw != nil {
+		t.Errorf("socket 5 = %+v, want only its ID and error", socket)
+	}
+}
+
+func TestChannelzLookups(t *testing.T) {
+	fake := newFakeChannelz()
+	debugger := New(transport.NewClientFromStubs(fake, nil, nil))
+	ctx := context.Background()
+
+	if channel, err := debugger.Channel(ctx, 2); err != nil || channel.Target != "control-plane:443" {
+		t.Errorf("Channel(2) = %+v, %v, want channel 2", channel, err)
+	}
+	if _, err := debugger.Channel(ctx, 9); status.Code(err) != codes.NotFound {
+		t.Errorf("Channel(9) = %v, want NotFound", err)
+	}
+	if channel, _ := debugger.ResolveChannel(ctx, fake.channels[1]); len(channel.Subchannels) != 1 || channel.Raw != fake.channels[1] {
+		t.Errorf("ResolveChannel() = %+v, want channel 1 with its subchannel", channel)
+	}
+	if subchannel, _ := debugger.Subchannel(ctx, 3); subchannel.Target != "10.0.0.1:8080" || len(subchannel.Sockets) != 2 {
+		t.Errorf("Subchannel(3) = %+v, want subchannel 3 with its sockets", subchannel)
+	}
+	if subchannel, err := debugger.Subchannel(ctx, 9); subchannel.ID != 9 || subchannel.Err == nil || err == nil {
+		t.Errorf("Subchannel(9) = %+v, %v, want only its ID and error", subchannel, err)
+	}
+	if socket, err := debugger.Socket(ctx, 8); err != nil || socket.MessagesReceived != 5 {
+		t.Errorf("Socket(8) = %+v, %v, want socket 8", socket, err)
+	}
+	if socket, err := debugger.Socket(ctx, 9); socket.ID != 9 || status.Code(socket.Err) != codes.NotFound || err == nil {
+		t.Errorf("Socket(9) = %+v, %v, want only its ID and error", socket, err)
+	}
+}
+
+func TestServers(t *testing.T) {
+	debugger := New(transport.NewClientFromStubs(newFakeChannelz(), nil, nil))
+	ctx := context.Background()
+	servers, err := debugger.Servers(ctx)
+	if err != nil || len(servers) != 1 {
+		t.Fatalf("Servers() = %+v, %v, want server 6", servers, err)
+	}
+	server := servers[0]
+	if server.ID != 6 || server.Calls != (CallCounts{Started: 10, Succeeded: 9}) {
+		t.Errorf("server = %+v, want server 6", server)
+	}
+	if len(server.ListenSockets) != 1 || server.ListenSockets[0].ID != 7 || len(server.Sockets) != 1 || server.Sockets[0].MessagesReceived != 5 {
+		t.Errorf("server sockets = %+v and %+v, want 7 and 8", server.ListenSockets, server.Sockets)
+	}
+	if server, err := debugger.Server(ctx, 6); err != nil || len(server.Sockets) != 1 {
+		t.Errorf("Server(6) = %+v, %v, want server 6 with its sockets", server, err)
+	}
+	if _, err := debugger.Server(ctx, 9); status.Code(err) != codes.NotFound {
+		t.Errorf("Server(9) = %v, want NotFound", err)
+	}
+}
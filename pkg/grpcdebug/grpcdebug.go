@@ -0,0 +1,51 @@
+// Package grpcdebug fetches the state of a gRPC application from its admin
+// services, and resolves it into typed views: channels with their subchannels
+// and sockets, servers with their sockets, and the status of xDS resources.
+//
+// It does not print anything, so it can be used from other tools and from
+// integration tests:
+//
+//	debugger, err := grpcdebug.Connect(ctx, config)
+//	if err != nil {
+//		return err
+//	}
+//	defer debugger.Close()
+//	channels, err := debugger.Channels(ctx)
+//
+// Views that could not be fetched are kept with their ID and Err set, and the
+// first such error is returned alongside everything that succeeded.
+package grpcdebug
+
+import (
+	"context"
+
+	"grpcdebug/transport"
+)
+
+// Debugger resolves the admin services of one target into views. It is safe
+// for concurrent use.
+type Debugger struct {
+	client *transport.Client
+}
+
+// New returns a Debugger issuing its RPCs through client. The client stays
+// owned by the caller.
+func New(client *transport.Client) *Debugger {
+	return &Debugger{client: client}
+}
+
+// Connect connects to the target described by the resolved config, see
+// transport.GetServerConfig and transport.MatchServerConfig. The returned
+// Debugger owns the connection, and must be closed.
+func Connect(ctx context.Context, config transport.ServerConfig, options ...transport.ClientOption) (*Debugger, error) {
+	client, err := transport.NewClient(ctx, config, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &Debugger{client: client}, nil
+}
+
+// Close releases the connection of the underlying client
+func (d *Debugger) Close() error {
+	return d.client.Close()
+}
@@ -0,0 +1,115 @@
+package grpcdebug
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"grpcdebug/transport"
+
+	clusterpb "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	endpointpb "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	routepb "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	csdspb "github.com/envoyproxy/go-control-plane/envoy/service/status/v3"
+	"github.com/golang/protobuf/ptypes"
+)
+
+// XdsResourceStatus is the synchronization status of one xDS resource
+type XdsResourceStatus struct {
+	Name string
+	// The name of the client status, like ACKED or NACKED
+	Status      string
+	Version     string
+	Type        string
+	LastUpdated time.Time
+}
+
+// XdsResourceStatuses returns the status of every dynamic xDS resource of the
+// target, listeners first, then route configs, clusters and endpoints.
+func (d *Debugger) XdsResourceStatuses(ctx context.Context) ([]XdsResourceStatus, error) {
+	clientStatus, err := d.client.FetchClientStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return resourceStatuses(clientStatus)
+}
+
+// resourceStatuses extracts the status of every dynamic xDS resource from a
+// CSDS response
+func resourceStatuses(clientStatus *csdspb.ClientStatusResponse) ([]XdsResourceStatus, error) {
+	if len(clientStatus.Config) == 0 {
+		return nil, fmt.Errorf("the CSDS response has no config")
+	}
+	var entries []XdsResourceStatus
+	for _, xdsConfig := range clientStatus.Config[0].XdsConfig {
+		switch x := xdsConfig.PerXdsConfig.(type) {
+		case *csdspb.PerXdsConfig_ListenerConfig:
+			for _, dynamicListener := range xdsConfig.GetListenerConfig().DynamicListeners {
+				var entry = XdsResourceStatus{
+					Name:   dynamicListener.Name,
+					Status: dynamicListener.ClientStatus.String(),
+				}
+				if state := dynamicListener.GetActiveState(); state != nil {
+					entry.Version = state.VersionInfo
+					entry.Type = state.Listener.GetTypeUrl()
+					entry.LastUpdated = transport.TimeOf(state.LastUpdated)
+				}
+				entries = append(entries, entry)
+			}
+		case *csdspb.PerXdsConfig_RouteConfig:
+			for _, dynamicRouteConfig := range xdsConfig.GetRouteConfig().DynamicRouteConfigs {
+				var entry = XdsResourceStatus{
+					Status:      dynamicRouteConfig.ClientStatus.String(),
+					Version:     dynamicRouteConfig.VersionInfo,
+					Type:        dynamicRouteConfig.RouteConfig.GetTypeUrl(),
+					LastUpdated: transport.TimeOf(dynamicRouteConfig.LastUpdated),
+				}
+				if packed := dynamicRouteConfig.GetRouteConfig(); packed != nil {
+					var routeConfig routepb.RouteConfiguration
+					if err := ptypes.UnmarshalAny(packed, &routeConfig); err != nil {
+						return nil, err
+					}
+					entry.Name = routeConfig.Name
+				}
+				entries = append(entries, entry)
+			}
+		case *csdspb.PerXdsConfig_ClusterConfig:
+			for _, dynamicCluster := range xdsConfig.GetClusterConfig().DynamicActiveClusters {
+				var entry = XdsResourceStatus{
+					Status:      dynamicCluster.ClientStatus.String(),
+					Version:     dynamicCluster.VersionInfo,
+					Type:        dynamicCluster.Cluster.GetTypeUrl(),
+					LastUpdated: transport.TimeOf(dynamicCluster.LastUpdated),
+				}
+				if packed := dynamicCluster.GetCluster(); packed != nil {
+					var cluster clusterpb.Cluster
+					if err := ptypes.UnmarshalAny(packed, &cluster); err != nil {
+						return nil, err
+					}
+					entry.Name = cluster.Name
+				}
+				entries = append(entries, entry)
+			}
+		case *csdspb.PerXdsConfig_EndpointConfig:
+			for _, dynamicEndpoint := range xdsConfig.GetEndpointConfig().GetDynamicEndpointConfigs() {
+				var entry = XdsResourceStatus{
+					Status:      dynamicEndpoint.ClientStatus.String(),
+					Version:     dynamicEndpoint.VersionInfo,
+					Type:        dynamicEndpoint.EndpointConfig.GetTypeUrl(),
+					LastUpdated: transport.TimeOf(dynamicEndpoint.LastUpdated),
+				}
+				if packed := dynamicEndpoint.GetEndpointConfig(); packed != nil {
+					var endpoint endpointpb.ClusterLoadAssignment
+					if err := ptypes.UnmarshalAny(packed, &endpoint); err != nil {
+						return nil, err
+					}
+					entry.Name = endpoint.ClusterName
+				}
+				entries = append(entries, entry)
+			}
+		default:
+			return nil, fmt.Errorf("Unexpected type %T", x)
+		}
+	}
+	return entries, nil
+}
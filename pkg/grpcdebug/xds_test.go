@@ -0,0 +1,110 @@
+package grpcdebug
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"grpcdebug/transport"
+
+	adminpb "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	clusterpb "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	endpointpb "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	routepb "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	csdspb "github.com/envoyproxy/go-control-plane/envoy/service/status/v3"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	anypb "github.com/golang/protobuf/ptypes/any"
+	"google.golang.org/grpc"
+)
+
+// fakeCSDS answers FetchClientStatus with a fixed response
+type fakeCSDS struct {
+	csdspb.ClientStatusDiscoveryServiceClient
+	resp *csdspb.ClientStatusResponse
+}
+
+func (f *fakeCSDS) FetchClientStatus(ctx context.Context, in *csdspb.ClientStatusRequest, opts ...grpc.CallOption) (*csdspb.ClientStatusResponse, error) {
+	return f.resp, nil
+}
+
+func mustMarshalAny(t *testing.T, m proto.Message) *anypb.Any {
+	t.Helper()
+	packed, err := ptypes.MarshalAny(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packed
+}
+
+func TestXdsResourceStatuses(t *testing.T) {
+	updated := time.Date(2021, 3, 30, 21, 52, 34, 0, time.UTC)
+	timestamp, err := ptypes.TimestampProto(updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := &csdspb.ClientStatusResponse{Config: []*csdspb.ClientConfig{{
+		XdsConfig: []*csdspb.PerXdsConfig{
+			{PerXdsConfig: &csdspb.PerXdsConfig_ListenerConfig{ListenerConfig: &adminpb.ListenersConfigDump{
+				DynamicListeners: []*adminpb.ListenersConfigDump_DynamicListener{
+					{
+						Name:         "server:1337",
+						ClientStatus: adminpb.ClientResourceStatus_ACKED,
+						ActiveState: &adminpb.ListenersConfigDump_DynamicListenerState{
+							VersionInfo: "1",
+							Listener:    &anypb.Any{TypeUrl: "type.googleapis.com/envoy.config.listener.v3.Listener"},
+							LastUpdated: timestamp,
+						},
+					},
+					// A listener that was requested but never received
+					{Name: "missing:1337", ClientStatus: adminpb.ClientResourceStatus_REQUESTED},
+				},
+			}}},
+			{PerXdsConfig: &csdspb.PerXdsConfig_RouteConfig{RouteConfig: &adminpb.RoutesConfigDump{
+				DynamicRouteConfigs: []*adminpb.RoutesConfigDump_DynamicRouteConfig{{
+					VersionInfo:  "2",
+					RouteConfig:  mustMarshalAny(t, &routepb.RouteConfiguration{Name: "route"}),
+					LastUpdated:  timestamp,
+					ClientStatus: adminpb.ClientResourceStatus_ACKED,
+				}},
+			}}},
+			{PerXdsConfig: &csdspb.PerXdsConfig_ClusterConfig{ClusterConfig: &adminpb.ClustersConfigDump{
+				DynamicActiveClusters: []*adminpb.ClustersConfigDump_DynamicCluster{{
+					VersionInfo:  "3",
+					Cluster:      mustMarshalAny(t, &clusterpb.Cluster{Name: "cluster"}),
+					ClientStatus: adminpb.ClientResourceStatus_NACKED,
+				}},
+			}}},
+			{PerXdsConfig: &csdspb.PerXdsConfig_EndpointConfig{EndpointConfig: &adminpb.EndpointsConfigDump{
+				DynamicEndpointConfigs: []*adminpb.EndpointsConfigDump_DynamicEndpointConfig{{
+					VersionInfo:    "4",
+					EndpointConfig: mustMarshalAny(t, &endpointpb.ClusterLoadAssignment{ClusterName: "endpoints"}),
+					ClientStatus:   adminpb.ClientResourceStatus_ACKED,
+				}},
+			}}},
+		},
+	}}}
+	debugger := New(transport.NewClientFromStubs(nil, &fakeCSDS{resp: resp}, nil))
+	got, err := debugger.XdsResourceStatuses(context.Background())
+	if err != nil {
+		t.Fatalf("XdsResourceStatuses() failed: %v", err)
+	}
+	want := []XdsResourceStatus{
+		{Name: "server:1337", Status: "ACKED", Version: "1", Type: "type.googleapis.com/envoy.config.listener.v3.Listener", LastUpdated: updated},
+		{Name: "missing:1337", Status: "REQUESTED"},
+		{Name: "route", Status: "ACKED", Version: "2", Type: "type.googleapis.com/envoy.config.route.v3.RouteConfiguration", LastUpdated: updated},
+		{Name: "cluster", Status: "NACKED", Version: "3", Type: "type.googleapis.com/envoy.config.cluster.v3.Cluster"},
+		{Name: "endpoints", Status: "ACKED", Version: "4", Type: "type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("XdsResourceStatuses() = %+v, want %+v", got, want)
+	}
+}
+
+func TestXdsResourceStatusesWithoutConfig(t *testing.T) {
+	debugger := New(transport.NewClientFromStubs(nil, &fakeCSDS{resp: &csdspb.ClientStatusResponse{}}, nil))
+	if _, err := debugger.XdsResourceStatuses(context.Background()); err == nil {
+		t.Error("XdsResourceStatuses() succeeded without a config, want an error")
+	}
+}
@@ -2,10 +2,8 @@ package transport
 
 import (
 	"fmt"
-	"log"
 	"os"
-	"path"
-	"regexp"
+	"path/filepath"
 	"strings"
 )
 
@@ -14,6 +12,7 @@ type SecurityType int
 const (
 	TypeInsecure SecurityType = iota
 	TypeTls
+	TypeGoogleDefault
 )
 
 const GrpcdebugServerConfigEnvName = "GRPCDEBUG_CONFIG"
@@ -24,6 +23,8 @@ func (e SecurityType) String() string {
 		return "Insecure"
 	case TypeTls:
 		return "TLS"
+	case TypeGoogleDefault:
+		return "GoogleDefault"
 	default:
 		return fmt.Sprintf("%d", int(e))
 	}
@@ -32,102 +33,220 @@ func (e SecurityType) String() string {
 type ServerConfig struct {
 	// Only allow two wildcard * and ?
 	Pattern string
+	// The target given on the command line, set when the config is resolved
+	Target string
 	// If present, override the given target address
-	RealAddress        string
-	Security           SecurityType
-	IdentityFile       string
+	RealAddress  string
+	Security     SecurityType
+	IdentityFile string
+	// The client certificate and its private key, for mutual TLS
+	CertificateFile string
+	KeyFile         string
+	// Trust the system root CAs in addition to IdentityFile
+	UseSystemRoots     bool
 	ServerNameOverride string
+	// The application default credentials used in GoogleDefault mode; if
+	// empty, the usual ADC locations are searched
+	GoogleCredentialsFile string
+	// Metadata attached to every admin RPC; Header may be repeated
+	Headers []Header
+	// A file holding a bearer token for the authorization header
+	TokenFile string
+	// Tunnels the connection through an HTTP CONNECT proxy or an SSH jump
+	// host; see proxyDialer for the syntax
+	ProxyJump string
+	// The options explicitly set in the config file, so that merging can tell
+	// them apart from zero values
+	set map[string]bool
+	// Where the block starts, and where each option is last set, for
+	// diagnostics
+	position        ConfigPosition
+	optionPositions map[string]ConfigPosition
 }
 
-func parseServerPattern(x string) (string, error) {
-	var matcher = regexp.MustCompile(`^Server\s+?([A-Za-z0-9-_\.\*\?:]*)$`)
-	tokens := matcher.FindStringSubmatch(x)
-	if len(tokens) != 2 {
-		return "", fmt.Errorf("Invalid server pattern: %v", x)
+// ParseSecurityType parses the security model names accepted by both the
+// config file and the --security flag
+func ParseSecurityType(value string) (SecurityType, error) {
+	switch strings.ToLower(value) {
+	case "insecure":
+		return TypeInsecure, nil
+	case "tls":
+		return TypeTls, nil
+	case "google-default", "googledefault":
+		return TypeGoogleDefault, nil
+	default:
+		return TypeInsecure, fmt.Errorf("Unsupported security model: %v", value)
 	}
-	return strings.TrimSpace(tokens[1]), nil
 }
 
-func parseServerOption(x string) (string, string, error) {
-	var matcher = regexp.MustCompile(`^(\w+?)\s+?(\S*)$`)
-	tokens := matcher.FindStringSubmatch(x)
-	if len(tokens) != 3 {
-		return "", "", fmt.Errorf("Invalid server option: %v", x)
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes", "true":
+		return true, nil
+	case "no", "false":
+		return false, nil
+	default:
+		return false, fmt.Errorf("Invalid boolean: %v", value)
 	}
-	return strings.TrimSpace(tokens[1]), strings.TrimSpace(tokens[2]), nil
 }
 
-func LoadServerConfigsFromFile(path string) []ServerConfig {
-	bytes, err := os.ReadFile(path)
-	if err != nil {
-		panic(err)
-	}
-	lines := strings.Split(string(bytes), "\n")
-	var configs []ServerConfig
-	var current *ServerConfig
-	for i, line := range lines {
-		if strings.HasPrefix(line, "Server") {
-			pattern, err := parseServerPattern(line)
-			if err != nil {
-				log.Fatalf("Failed to parse config [%v:%d]: %v", path, i, err)
+// MatchPattern reports whether target matches pattern, where * matches any
+// sequence of characters, and ? matches exactly one character.
+func MatchPattern(pattern, target string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			// Collapse consecutive stars, then try every possible suffix
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
 			}
-			configs = append(configs, ServerConfig{Pattern: pattern})
-			current = &configs[len(configs)-1]
-		} else {
-			stem := strings.TrimSpace(line)
-			if stem == "" {
-				// Allow black lines, skip them
-				continue
+			if pattern == "" {
+				return true
 			}
-			key, value, err := parseServerOption(stem)
-			if err != nil {
-				log.Fatalf("Failed to parse config [%v:%d]: %v", path, i, err)
-			}
-			switch key {
-			case "RealAddress":
-				current.RealAddress = value
-			case "Security":
-				switch strings.ToLower(value) {
-				case "insecure":
-					current.Security = TypeInsecure
-				case "tls":
-					current.Security = TypeTls
-				default:
-					log.Fatalf("Unsupported security model: %v", value)
+			for i := 0; i <= len(target); i++ {
+				if MatchPattern(pattern, target[i:]) {
+					return true
 				}
-			case "IdentityFile":
-				current.IdentityFile = value
-			case "ServerNameOverride":
-				current.ServerNameOverride = value
+			}
+			return false
+		case '?':
+			if target == "" {
+				return false
+			}
+		default:
+			if target == "" || pattern[0] != target[0] {
+				return false
 			}
 		}
+		pattern = pattern[1:]
+		target = target[1:]
 	}
-	log.Printf("Loaded server configs from %v", path)
-	return configs
+	return target == ""
 }
 
-func LoadServerConfigs() []ServerConfig {
+// mergeUnset copies the options set in other that are not set in c yet.
+// Headers accumulate across blocks instead.
+func (c *ServerConfig) mergeUnset(other ServerConfig) {
+	isSet := func(key string) bool {
+		return c.set[key]
+	}
+	if !isSet("RealAddress") {
+		c.RealAddress = other.RealAddress
+	}
+	if !isSet("Security") {
+		c.Security = other.Security
+	}
+	if !isSet("IdentityFile") {
+		c.IdentityFile = other.IdentityFile
+	}
+	if !isSet("CertificateFile") {
+		c.CertificateFile = other.CertificateFile
+	}
+	if !isSet("KeyFile") {
+		c.KeyFile = other.KeyFile
+	}
+	if !isSet("UseSystemRoots") {
+		c.UseSystemRoots = other.UseSystemRoots
+	}
+	if !isSet("ServerNameOverride") {
+		c.ServerNameOverride = other.ServerNameOverride
+	}
+	if !isSet("GoogleCredentialsFile") {
+		c.GoogleCredentialsFile = other.GoogleCredentialsFile
+	}
+	if !isSet("TokenFile") {
+		c.TokenFile = other.TokenFile
+	}
+	if !isSet("ProxyJump") {
+		c.ProxyJump = other.ProxyJump
+	}
+	c.Headers = append(c.Headers, other.Headers...)
+	if c.set == nil {
+		c.set = make(map[string]bool)
+	}
+	for key := range other.set {
+		if pos, ok := other.optionPositions[key]; ok && !c.set[key] {
+			if c.optionPositions == nil {
+				c.optionPositions = make(map[string]ConfigPosition)
+			}
+			c.optionPositions[key] = pos
+		}
+		c.set[key] = true
+	}
+}
+
+// MatchServerConfig resolves the config of target like ssh_config does: every
+// block whose pattern matches contributes, and for each option the first
+// block that sets it wins. The global defaults come last.
+func MatchServerConfig(configs *ServerConfigs, target string) ServerConfig {
+	var result ServerConfig
+	for _, config := range configs.Servers {
+		if !MatchPattern(config.Pattern, target) {
+			continue
+		}
+		if result.Pattern == "" {
+			result.Pattern = config.Pattern
+			result.position = config.position
+		}
+		result.mergeUnset(config)
+	}
+	result.mergeUnset(configs.Defaults)
+	return result
+}
+
+// FindServerConfigFile returns the config file in use, or "" if there is none.
+// It is the file named by GRPCDEBUG_CONFIG, or grpcdebug_config in the working
+// directory, or grpcdebug_config in the user config directory.
+func FindServerConfigFile() string {
 	if value := os.Getenv(GrpcdebugServerConfigEnvName); value != "" {
-		return LoadServerConfigsFromFile(value)
+		return value
 	}
 	// Try to load from work directory, if exists
 	if _, err := os.Stat("./grpcdebug_config"); err == nil {
-		return LoadServerConfigsFromFile("./grpcdebug_config")
+		return "./grpcdebug_config"
 	}
 	// Try to load from user config directory, if exists
 	dir, _ := os.UserConfigDir()
-	defaultUserConfig := path.Join(dir, "grpcdebug_config")
+	defaultUserConfig := filepath.Join(dir, "grpcdebug_config")
 	if _, err := os.Stat(defaultUserConfig); err == nil {
-		return LoadServerConfigsFromFile(defaultUserConfig)
+		return defaultUserConfig
 	}
-	return nil
+	return ""
 }
 
-func GetServerConfig(target string) ServerConfig {
-	for _, config := range LoadServerConfigs() {
-		if config.Pattern == target {
-			return config
-		}
+// LoadServerConfigs loads the config file in use; no file means no configs
+func LoadServerConfigs() (*ServerConfigs, error) {
+	path := FindServerConfigFile()
+	if path == "" {
+		return &ServerConfigs{}, nil
+	}
+	return LoadServerConfigsFromFile(path)
+}
+
+// Position returns where the block is defined, as "file:line"
+func (c ServerConfig) Position() string {
+	if c.position.Path == "" {
+		return ""
+	}
+	return fmt.Sprintf("%v:%d", c.position.Path, c.position.Line)
+}
+
+// DialAddress returns the address to connect to: RealAddress if the config
+// rewrites the target, or the target itself
+func (c ServerConfig) DialAddress() string {
+	if c.RealAddress != "" {
+		return c.RealAddress
+	}
+	return c.Target
+}
+
+// GetServerConfig resolves the config of target from the config files
+func GetServerConfig(target string) (ServerConfig, error) {
+	configs, err := LoadServerConfigs()
+	if err != nil {
+		return ServerConfig{}, err
 	}
-	return ServerConfig{}
+	config := MatchServerConfig(configs, target)
+	config.Target = target
+	return config, nil
 }
@@ -0,0 +1,390 @@
+package transport
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Nested includes deeper than this are most likely a mistake
+const maxIncludeDepth = 16
+
+var serverPatternMatcher = regexp.MustCompile(`^[A-Za-z0-9-_\.\*\?:/@]+$`)
+
+// ConfigPosition locates a token in a config file; Line and Column start at 1
+type ConfigPosition struct {
+	Path   string
+	Line   int
+	Column int
+}
+
+func (p ConfigPosition) String() string {
+	return fmt.Sprintf("%v:%d:%d", p.Path, p.Line, p.Column)
+}
+
+// ConfigError is a problem found in a config file, either fatal or reported as
+// a warning
+type ConfigError struct {
+	ConfigPosition
+	Msg string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%v: %v", e.ConfigPosition, e.Msg)
+}
+
+// ServerConfigs is the content of a config file, including the files it
+// includes
+type ServerConfigs struct {
+	// The file the configs were loaded from
+	Path string
+	// Options given before the first Server line; they apply to every target,
+	// after all matching blocks
+	Defaults ServerConfig
+	Servers  []ServerConfig
+	// The target used when none is given on the command line
+	CurrentTarget string
+	// Problems that do not prevent using the configs, like unknown options
+	Warnings []*ConfigError
+}
+
+// configOptions maps the lowercased option names to their canonical spelling;
+// like ssh_config, option names are case insensitive
+var configOptions = map[string]string{}
+
+func init() {
+	for _, key := range []string{
+		"RealAddress",
+		"Security",
+		"IdentityFile",
+		"CertificateFile",
+		"KeyFile",
+		"UseSystemRoots",
+		"ServerNameOverride",
+		"GoogleCredentialsFile",
+		"Header",
+		"TokenFile",
+		"ProxyJump",
+	} {
+		configOptions[strings.ToLower(key)] = key
+	}
+}
+
+// expandHome expands a leading "~/" to the home directory
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	return path
+}
+
+// configLine is a non-blank line split into an option and its value
+type configLine struct {
+	key, value       string
+	keyCol, valueCol int
+}
+
+// splitConfigLine splits "Key value", "Key=value" or "Key = value", dropping
+// comments. A value may be double quoted to keep a "#" or surrounding spaces.
+// Blank and comment lines yield an empty key.
+func splitConfigLine(line string) (configLine, error) {
+	var result configLine
+	line = strings.TrimRight(line, "\r")
+	i := 0
+	for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+		i++
+	}
+	if i == len(line) || line[i] == '#' {
+		return result, nil
+	}
+	result.keyCol = i + 1
+	j := i
+	for j < len(line) && line[j] != ' ' && line[j] != '\t' && line[j] != '=' {
+		j++
+	}
+	result.key = line[i:j]
+	for j < len(line) && (line[j] == ' ' || line[j] == '\t') {
+		j++
+	}
+	if j < len(line) && line[j] == '=' {
+		j++
+		for j < len(line) && (line[j] == ' ' || line[j] == '\t') {
+			j++
+		}
+	}
+	result.valueCol = j + 1
+	rest := line[j:]
+	if strings.HasPrefix(rest, "\"") {
+		end := strings.Index(rest[1:], "\"")
+		if end < 0 {
+			return result, fmt.Errorf("unterminated quote")
+		}
+		result.value = rest[1 : end+1]
+		trailing := strings.TrimSpace(rest[end+2:])
+		if trailing != "" && !strings.HasPrefix(trailing, "#") {
+			return result, fmt.Errorf("unexpected %q after quoted value", trailing)
+		}
+		return result, nil
+	}
+	// A "#" starts a comment only at the beginning of a word
+	for k := 0; k < len(rest); k++ {
+		if rest[k] == '#' && k > 0 && (rest[k-1] == ' ' || rest[k-1] == '\t') {
+			rest = rest[:k]
+			break
+		}
+	}
+	result.value = strings.TrimSpace(rest)
+	return result, nil
+}
+
+type configParser struct {
+	configs *ServerConfigs
+	// Index of the Server block being parsed, or -1 for the defaults
+	current int
+	// Files being parsed, to detect include cycles
+	visiting map[string]bool
+}
+
+// LoadServerConfigsFromFile parses the config file at path, and the files it
+// includes
+func LoadServerConfigsFromFile(path string) (*ServerConfigs, error) {
+	p := &configParser{
+		configs:  &ServerConfigs{Path: path},
+		current:  -1,
+		visiting: make(map[string]bool),
+	}
+	if err := p.parseFile(path, 0); err != nil {
+		return nil, err
+	}
+	return p.configs, nil
+}
+
+func (p *configParser) target() *ServerConfig {
+	if p.current < 0 {
+		return &p.configs.Defaults
+	}
+	return &p.configs.Servers[p.current]
+}
+
+func (p *configParser) warn(pos ConfigPosition, format string, a ...interface{}) {
+	p.configs.Warnings = append(p.configs.Warnings, &ConfigError{ConfigPosition: pos, Msg: fmt.Sprintf(format, a...)})
+}
+
+func (p *configParser) parseFile(path string, depth int) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	if p.visiting[abs] {
+		return fmt.Errorf("include cycle through %v", path)
+	}
+	p.visiting[abs] = true
+	defer delete(p.visiting, abs)
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %v", err)
+	}
+	for i, line := range strings.Split(string(bytes), "\n") {
+		parsed, err := splitConfigLine(line)
+		pos := ConfigPosition{Path: path, Line: i + 1, Column: parsed.valueCol}
+		if err != nil {
+			return &ConfigError{ConfigPosition: pos, Msg: err.Error()}
+		}
+		if parsed.key == "" {
+			continue
+		}
+		keyPos := ConfigPosition{Path: path, Line: i + 1, Column: parsed.keyCol}
+		if parsed.value == "" {
+			return &ConfigError{ConfigPosition: keyPos, Msg: fmt.Sprintf("missing value for %v", parsed.key)}
+		}
+		switch strings.ToLower(parsed.key) {
+		case "server":
+			if !serverPatternMatcher.MatchString(parsed.value) {
+				return &ConfigError{ConfigPosition: pos, Msg: fmt.Sprintf("invalid server pattern %q", parsed.value)}
+			}
+			p.configs.Servers = append(p.configs.Servers, ServerConfig{Pattern: parsed.value, position: keyPos})
+			p.current = len(p.configs.Servers) - 1
+		case "currenttarget":
+			if p.current >= 0 {
+				return &ConfigError{ConfigPosition: keyPos, Msg: "CurrentTarget must come before any Server line"}
+			}
+			p.configs.CurrentTarget = parsed.value
+		case "include":
+			if depth >= maxIncludeDepth {
+				return &ConfigError{ConfigPosition: keyPos, Msg: "too many nested includes"}
+			}
+			if err := p.include(parsed.value, filepath.Dir(path), pos, depth); err != nil {
+				return err
+			}
+		default:
+			if err := p.applyOption(parsed.key, parsed.value, keyPos, pos); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// include parses every file matching the space separated globs in value.
+// Relative paths are relative to the directory of the including file.
+func (p *configParser) include(value, dir string, pos ConfigPosition, depth int) error {
+	for _, pattern := range strings.Fields(value) {
+		pattern = expandHome(pattern)
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return &ConfigError{ConfigPosition: pos, Msg: fmt.Sprintf("invalid include pattern %q: %v", pattern, err)}
+		}
+		if len(matches) == 0 {
+			p.warn(pos, "include %q matches no file", pattern)
+		}
+		for _, match := range matches {
+			// Options after the Include line belong to the block it is in, not
+			// to the last block of the included file
+			current := p.current
+			err := p.parseFile(match, depth+1)
+			p.current = current
+			if err != nil {
+				if _, ok := err.(*ConfigError); ok {
+					return err
+				}
+				return &ConfigError{ConfigPosition: pos, Msg: err.Error()}
+			}
+		}
+	}
+	return nil
+}
+
+func (p *configParser) applyOption(key, value string, keyPos, pos ConfigPosition) error {
+	canonical, ok := configOptions[strings.ToLower(key)]
+	if !ok {
+		p.warn(keyPos, "unknown option %q", key)
+		return nil
+	}
+	current := p.target()
+	if p.current < 0 && current.position.Path == "" {
+		current.position = keyPos
+	}
+	if current.set == nil {
+		current.set = make(map[string]bool)
+		current.optionPositions = make(map[string]ConfigPosition)
+	}
+	if current.set[canonical] && canonical != "Header" {
+		p.warn(keyPos, "%v is set more than once, the last value wins", canonical)
+	}
+	current.set[canonical] = true
+	current.optionPositions[canonical] = keyPos
+	var err error
+	switch canonical {
+	case "RealAddress":
+		current.RealAddress = value
+	case "Security":
+		current.Security, err = ParseSecurityType(value)
+	case "IdentityFile":
+		current.IdentityFile = expandHome(value)
+	case "CertificateFile":
+		current.CertificateFile = expandHome(value)
+	case "KeyFile":
+		current.KeyFile = expandHome(value)
+	case "UseSystemRoots":
+		current.UseSystemRoots, err = parseBool(value)
+	case "ServerNameOverride":
+		current.ServerNameOverride = value
+	case "GoogleCredentialsFile":
+		current.GoogleCredentialsFile = expandHome(value)
+	case "Header":
+		var header Header
+		header, err = ParseHeader(value)
+		current.Headers = append(current.Headers, header)
+	case "TokenFile":
+		current.TokenFile = expandHome(value)
+	case "ProxyJump":
+		current.ProxyJump = value
+	}
+	if err != nil {
+		return &ConfigError{ConfigPosition: pos, Msg: err.Error()}
+	}
+	return nil
+}
+
+// Check reports settings that parse fine but cannot work, like referenced
+// files that do not exist or an incomplete client certificate. Options that
+// stand alone are checked block by block, while the ones that depend on other
+// options are checked on the config each pattern resolves to, since blocks
+// merge like in ssh_config.
+func (c *ServerConfigs) Check() []*ConfigError {
+	var problems []*ConfigError
+	reported := make(map[string]bool)
+	// Problems are reported at the line of the option, or of the block. The
+	// same block may take part in several resolved configs, but its problems
+	// are reported once.
+	report := func(config ServerConfig, option, format string, a ...interface{}) {
+		pos, ok := config.optionPositions[option]
+		if !ok {
+			pos = config.position
+		}
+		problem := &ConfigError{ConfigPosition: pos, Msg: fmt.Sprintf(format, a...)}
+		if !reported[problem.Error()] {
+			reported[problem.Error()] = true
+			problems = append(problems, problem)
+		}
+	}
+	checkBlock := func(config ServerConfig) {
+		for _, file := range []struct{ option, path string }{
+			{"IdentityFile", config.IdentityFile},
+			{"CertificateFile", config.CertificateFile},
+			{"KeyFile", config.KeyFile},
+			{"GoogleCredentialsFile", config.GoogleCredentialsFile},
+			{"TokenFile", config.TokenFile},
+		} {
+			if file.path == "" {
+				continue
+			}
+			if _, err := os.Stat(file.path); err != nil {
+				report(config, file.option, "%v %v is not accessible: %v", file.option, file.path, err)
+			}
+		}
+		if config.ProxyJump != "" && config.ProxyJump != ProxyNone {
+			if _, err := proxyDialer(config.ProxyJump); err != nil {
+				report(config, "ProxyJump", "%v", err)
+			}
+		}
+	}
+	checkResolved := func(config ServerConfig) {
+		if config.CertificateFile != "" && config.KeyFile == "" {
+			report(config, "CertificateFile", "CertificateFile and KeyFile must be set together")
+		} else if config.CertificateFile == "" && config.KeyFile != "" {
+			report(config, "KeyFile", "CertificateFile and KeyFile must be set together")
+		}
+		if config.Security == TypeTls && config.IdentityFile == "" && !config.UseSystemRoots && config.set["Security"] {
+			report(config, "Security", "TLS requires an IdentityFile, or UseSystemRoots yes")
+		}
+		if config.Security == TypeInsecure && config.set["Security"] &&
+			(config.IdentityFile != "" || config.CertificateFile != "" || config.GoogleCredentialsFile != "") {
+			report(config, "Security", "credentials are ignored under Insecure security")
+		}
+	}
+	// Targets matching no block only get the defaults
+	matchAll := false
+	for _, config := range c.Servers {
+		matchAll = matchAll || strings.Trim(config.Pattern, "*") == ""
+	}
+	if len(c.Defaults.set) > 0 {
+		checkBlock(c.Defaults)
+		if !matchAll {
+			checkResolved(c.Defaults)
+		}
+	}
+	for _, config := range c.Servers {
+		checkBlock(config)
+		// A pattern stands for the targets it matches, wildcards included
+		checkResolved(MatchServerConfig(c, config.Pattern))
+	}
+	return problems
+}
@@ -0,0 +1,198 @@
+package transport
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitConfigLine(t *testing.T) {
+	for _, test := range []struct {
+		line    string
+		want    configLine
+		wantErr bool
+	}{
+		{line: "", want: configLine{}},
+		{line: "   \t", want: configLine{}},
+		{line: "# a comment", want: configLine{}},
+		{line: "  # an indented comment", want: configLine{}},
+		{line: "Server localhost:*", want: configLine{key: "Server", value: "localhost:*", keyCol: 1, valueCol: 8}},
+		{line: "\tSecurity tls", want: configLine{key: "Security", value: "tls", keyCol: 2, valueCol: 11}},
+		{line: "Security=tls", want: configLine{key: "Security", value: "tls", keyCol: 1, valueCol: 10}},
+		{line: "Security = tls", want: configLine{key: "Security", value: "tls", keyCol: 1, valueCol: 12}},
+		{line: "Security tls\r", want: configLine{key: "Security", value: "tls", keyCol: 1, valueCol: 10}},
+		{line: "Security tls # trailing", want: configLine{key: "Security", value: "tls", keyCol: 1, valueCol: 10}},
+		{line: "Header x-tag:a#b", want: configLine{key: "Header", value: "x-tag:a#b", keyCol: 1, valueCol: 8}},
+		{line: `Header "x-tag: a # b "`, want: configLine{key: "Header", value: "x-tag: a # b ", keyCol: 1, valueCol: 8}},
+		{line: `Header "x-tag:a" # trailing`, want: configLine{key: "Header", value: "x-tag:a", keyCol: 1, valueCol: 8}},
+		{line: "Security", want: configLine{key: "Security", keyCol: 1, valueCol: 9}},
+		{line: `Header "x-tag:a`, wantErr: true},
+		{line: `Header "x-tag:a" b`, wantErr: true},
+	} {
+		got, err := splitConfigLine(test.line)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("splitConfigLine(%q) succeeded, want an error", test.line)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("splitConfigLine(%q) failed: %v", test.line, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("splitConfigLine(%q) = %+v, want %+v", test.line, got, test.want)
+		}
+	}
+}
+
+// writeConfigFiles writes the files in a test directory, and returns the path
+// of the first one
+func writeConfigFiles(t *testing.T, files ...[2]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, file := range files {
+		if err := os.WriteFile(filepath.Join(dir, file[0]), []byte(file[1]), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, files[0][0])
+}
+
+func TestLoadServerConfigsInclude(t *testing.T) {
+	for _, test := range []struct {
+		name              string
+		main, included    string
+		wantCurrentTarget string
+		// The RealAddress of the defaults, then of each block
+		wantAddresses []string
+	}{
+		{
+			name:          "options after a top level include are defaults",
+			main:          "Include included\nRealAddress default:1\n",
+			included:      "Server included\nRealAddress included:1\n",
+			wantAddresses: []string{"default:1", "included:1"},
+		},
+		{
+			name:              "current target after a top level include",
+			main:              "Include included\nCurrentTarget prod\n",
+			included:          "Server included\nRealAddress included:1\n",
+			wantCurrentTarget: "prod",
+			wantAddresses:     []string{"", "included:1"},
+		},
+		{
+			name:          "options after an include in a block",
+			main:          "Server main\nInclude included\nRealAddress main:1\n",
+			included:      "Server included\nRealAddress included:1\n",
+			wantAddresses: []string{"", "main:1", "included:1"},
+		},
+		{
+			name:          "included options without a block",
+			main:          "Server main\nInclude included\n",
+			included:      "RealAddress main:1\n",
+			wantAddresses: []string{"", "main:1"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeConfigFiles(t, [2]string{"main", test.main}, [2]string{"included", test.included})
+			configs, err := LoadServerConfigsFromFile(path)
+			if err != nil {
+				t.Fatalf("LoadServerConfigsFromFile() failed: %v", err)
+			}
+			if configs.CurrentTarget != test.wantCurrentTarget {
+				t.Errorf("CurrentTarget = %q, want %q", configs.CurrentTarget, test.wantCurrentTarget)
+			}
+			addresses := []string{configs.Defaults.RealAddress}
+			for _, config := range configs.Servers {
+				addresses = append(addresses, config.RealAddress)
+			}
+			if strings.Join(addresses, ",") != strings.Join(test.wantAddresses, ",") {
+				t.Errorf("addresses = %q, want %q", addresses, test.wantAddresses)
+			}
+		})
+	}
+}
+
+func TestLoadServerConfigsErrors(t *testing.T) {
+	for _, test := range []struct {
+		name, config string
+		wantLine     int
+	}{
+		{"missing value", "Server a\nSecurity\n", 2},
+		{"invalid pattern", "Server a b\n", 1},
+		{"invalid security", "Server a\nSecurity ssl\n", 2},
+		{"current target in a block", "Server a\nCurrentTarget a\n", 2},
+		{"unterminated quote", "Header \"a:b\n", 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeConfigFiles(t, [2]string{"config", test.config})
+			_, err := LoadServerConfigsFromFile(path)
+			configErr, ok := err.(*ConfigError)
+			if !ok {
+				t.Fatalf("LoadServerConfigsFromFile() = %v, want a ConfigError", err)
+			}
+			if configErr.Line != test.wantLine {
+				t.Errorf("error at line %v, want %v: %v", configErr.Line, test.wantLine, err)
+			}
+		})
+	}
+	t.Run("include cycle", func(t *testing.T) {
+		path := writeConfigFiles(t, [2]string{"a", "Include b\n"}, [2]string{"b", "Include a\n"})
+		if _, err := LoadServerConfigsFromFile(path); err == nil || !strings.Contains(err.Error(), "include cycle") {
+			t.Errorf("LoadServerConfigsFromFile() = %v, want an include cycle", err)
+		}
+	})
+}
+
+func TestCheckPositions(t *testing.T) {
+	path := writeConfigFiles(t, [2]string{"config", strings.Join([]string{
+		"Server a",
+		"Security tls",
+		"RealAddress a:1",
+		"KeyFile " + filepath.Join(os.TempDir(), "grpcdebug-missing-key"),
+		"Server b",
+		"ProxyJump ftp://proxy",
+	}, "\n")})
+	configs, err := LoadServerConfigsFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, problem := range configs.Check() {
+		got = append(got, problem.ConfigPosition.String())
+	}
+	want := []string{path + ":4:1", path + ":4:1", path + ":2:1", path + ":6:1"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Check() positions = %q, want %q", got, want)
+	}
+}
+
+func TestCheckMergedConfig(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		config []string
+		want   int
+	}{
+		{
+			name:   "roots from a later wildcard",
+			config: []string{"Server prod", "Security tls", "Server *", "UseSystemRoots yes"},
+		},
+		{
+			name:   "roots only for another server",
+			config: []string{"Server prod", "Security tls", "Server staging", "UseSystemRoots yes"},
+			want:   1,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeConfigFiles(t, [2]string{"config", strings.Join(test.config, "\n")})
+			configs, err := LoadServerConfigsFromFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if problems := configs.Check(); len(problems) != test.want {
+				t.Errorf("Check() = %v, want %v problems", problems, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package transport
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchPattern(t *testing.T) {
+	for _, test := range []struct {
+		pattern, target string
+		want            bool
+	}{
+		{"localhost:50051", "localhost:50051", true},
+		{"localhost:50051", "localhost:50052", false},
+		{"localhost", "localhost:50051", false},
+		{"*", "", true},
+		{"*", "anything", true},
+		{"*:50051", "localhost:50051", true},
+		{"*:50051", "localhost:50052", false},
+		{"prod-*.example.com", "prod-1.example.com", true},
+		{"prod-*.example.com", "prod-.example.com", true},
+		{"prod-*.example.com", "staging-1.example.com", false},
+		{"a**b", "ab", true},
+		{"a**b", "axxb", true},
+		{"*a*b*", "xaybz", true},
+		{"*a*b*", "xbya", false},
+		{"localhost:5005?", "localhost:50051", true},
+		{"localhost:5005?", "localhost:5005", false},
+		{"localhost:5005?", "localhost:500511", false},
+		{"??", "ab", true},
+		{"", "", true},
+		{"", "localhost", false},
+	} {
+		if got := MatchPattern(test.pattern, test.target); got != test.want {
+			t.Errorf("MatchPattern(%q, %q) = %v, want %v", test.pattern, test.target, got, test.want)
+		}
+	}
+}
+
+// withSet marks the given options of config as set, as the parser does
+func withSet(config ServerConfig, keys ...string) ServerConfig {
+	config.set = make(map[string]bool)
+	for _, key := range keys {
+		config.set[key] = true
+	}
+	return config
+}
+
+func TestMergeUnset(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		config      ServerConfig
+		other       ServerConfig
+		want        ServerConfig
+		wantSetKeys []string
+	}{
+		{
+			name:        "copies unset options",
+			config:      ServerConfig{},
+			other:       withSet(ServerConfig{RealAddress: "10.0.0.1:50051", Security: TypeTls}, "RealAddress", "Security"),
+			want:        ServerConfig{RealAddress: "10.0.0.1:50051", Security: TypeTls},
+			wantSetKeys: []string{"RealAddress", "Security"},
+		},
+		{
+			name:        "keeps set options",
+			config:      withSet(ServerConfig{Security: TypeTls, IdentityFile: "ca.pem"}, "Security", "IdentityFile"),
+			other:       withSet(ServerConfig{Security: TypeGoogleDefault, IdentityFile: "other.pem", TokenFile: "token"}, "Security", "IdentityFile", "TokenFile"),
+			want:        ServerConfig{Security: TypeTls, IdentityFile: "ca.pem", TokenFile: "token"},
+			wantSetKeys: []string{"Security", "IdentityFile", "TokenFile"},
+		},
+		{
+			// Insecure is the zero value, but setting it explicitly still wins
+			name:        "keeps options set to their zero value",
+			config:      withSet(ServerConfig{Security: TypeInsecure, UseSystemRoots: false}, "Security", "UseSystemRoots"),
+			other:       withSet(ServerConfig{Security: TypeTls, UseSystemRoots: true}, "Security", "UseSystemRoots"),
+			want:        ServerConfig{Security: TypeInsecure},
+			wantSetKeys: []string{"Security", "UseSystemRoots"},
+		},
+		{
+			name:        "accumulates headers",
+			config:      withSet(ServerConfig{Headers: []Header{{"a", "1"}}}, "Header"),
+			other:       withSet(ServerConfig{Headers: []Header{{"b", "2"}, {"a", "3"}}}, "Header"),
+			want:        ServerConfig{Headers: []Header{{"a", "1"}, {"b", "2"}, {"a", "3"}}},
+			wantSetKeys: []string{"Header"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.config
+			got.mergeUnset(test.other)
+			want := withSet(test.want, test.wantSetKeys...)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("mergeUnset() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestMatchServerConfig(t *testing.T) {
+	configs := &ServerConfigs{
+		Defaults: withSet(ServerConfig{Security: TypeTls, UseSystemRoots: true, Headers: []Header{{"x-default", "1"}}}, "Security", "UseSystemRoots", "Header"),
+		Servers: []ServerConfig{
+			withSet(ServerConfig{Pattern: "prod-1:*", RealAddress: "10.0.0.1:50051"}, "RealAddress"),
+			withSet(ServerConfig{Pattern: "prod-*", RealAddress: "10.0.0.2:50051", IdentityFile: "prod.pem", Headers: []Header{{"x-env", "prod"}}}, "RealAddress", "IdentityFile", "Header"),
+			withSet(ServerConfig{Pattern: "local*", Security: TypeInsecure}, "Security"),
+			withSet(ServerConfig{Pattern: "*", IdentityFile: "any.pem", TokenFile: "token"}, "IdentityFile", "TokenFile"),
+		},
+	}
+	for _, test := range []struct {
+		name   string
+		target string
+		want   ServerConfig
+	}{
+		{
+			name:   "first matching block wins per option",
+			target: "prod-1:50051",
+			want: ServerConfig{
+				Pattern:        "prod-1:*",
+				RealAddress:    "10.0.0.1:50051",
+				Security:       TypeTls,
+				IdentityFile:   "prod.pem",
+				UseSystemRoots: true,
+				Headers:        []Header{{"x-env", "prod"}, {"x-default", "1"}},
+				TokenFile:      "token",
+			},
+		},
+		{
+			name:   "later blocks fill the gaps",
+			target: "prod-2:50051",
+			want: ServerConfig{
+				Pattern:        "prod-*",
+				RealAddress:    "10.0.0.2:50051",
+				Security:       TypeTls,
+				IdentityFile:   "prod.pem",
+				UseSystemRoots: true,
+				Headers:        []Header{{"x-env", "prod"}, {"x-default", "1"}},
+				TokenFile:      "token",
+			},
+		},
+		{
+			name:   "blocks override the defaults",
+			target: "localhost:50051",
+			want: ServerConfig{
+				Pattern:        "local*",
+				Security:       TypeInsecure,
+				IdentityFile:   "any.pem",
+				UseSystemRoots: true,
+				Headers:        []Header{{"x-default", "1"}},
+				TokenFile:      "token",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := MatchServerConfig(configs, test.target)
+			got.set = nil
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("MatchServerConfig(%q) = %+v, want %+v", test.target, got, test.want)
+			}
+		})
+	}
+	t.Run("no block matches", func(t *testing.T) {
+		got := MatchServerConfig(&ServerConfigs{
+			Servers: []ServerConfig{withSet(ServerConfig{Pattern: "prod-*", RealAddress: "10.0.0.2:50051"}, "RealAddress")},
+		}, "localhost:50051")
+		if got.Pattern != "" || got.RealAddress != "" {
+			t.Errorf("MatchServerConfig() = %+v, want an empty config", got)
+		}
+	})
+}
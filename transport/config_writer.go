@@ -0,0 +1,256 @@
+package transport
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultServerConfigFile is where a new config file is created when none is
+// in use
+func DefaultServerConfigFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "grpcdebug_config"), nil
+}
+
+// quoteConfigValue quotes values that would otherwise be split or cut short
+// by a comment
+func quoteConfigValue(value string) string {
+	if strings.ContainsAny(value, " \t#\"") || value != strings.TrimSpace(value) {
+		return "\"" + value + "\""
+	}
+	return value
+}
+
+// FormatServerConfig renders config as a Server block, listing only the
+// options that differ from their defaults
+func FormatServerConfig(config ServerConfig) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Server %v\n", config.Pattern)
+	option := func(key, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "  %v %v\n", key, quoteConfigValue(value))
+		}
+	}
+	option("RealAddress", config.RealAddress)
+	if config.Security != TypeInsecure || config.set["Security"] {
+		option("Security", config.Security.String())
+	}
+	option("IdentityFile", config.IdentityFile)
+	option("CertificateFile", config.CertificateFile)
+	option("KeyFile", config.KeyFile)
+	if config.UseSystemRoots {
+		option("UseSystemRoots", "yes")
+	}
+	option("ServerNameOverride", config.ServerNameOverride)
+	option("GoogleCredentialsFile", config.GoogleCredentialsFile)
+	for _, header := range config.Headers {
+		option("Header", header.Key+": "+header.Value)
+	}
+	option("TokenFile", config.TokenFile)
+	option("ProxyJump", config.ProxyJump)
+	return b.String()
+}
+
+// editConfigFile rewrites the lines of the config file at path with edit. A
+// missing file is treated as empty, and created along with its directory.
+func editConfigFile(path string, edit func(lines []string) ([]string, error)) error {
+	mode := os.FileMode(0600)
+	var lines []string
+	bytes, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if info, err := os.Stat(path); err == nil {
+			mode = info.Mode().Perm()
+		}
+		content := strings.TrimSuffix(string(bytes), "\n")
+		if content != "" {
+			lines = strings.Split(content, "\n")
+		}
+	case os.IsNotExist(err):
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+	lines, err = edit(lines)
+	if err != nil {
+		return err
+	}
+	content := strings.Join(lines, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	// Replace the file atomically, so a failed write never truncates it
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".grpcdebug_config")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// lineKey returns the lowercased option name of a config line, or ""
+func lineKey(line string) (string, string) {
+	parsed, err := splitConfigLine(line)
+	if err != nil {
+		return "", ""
+	}
+	return strings.ToLower(parsed.key), parsed.value
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func isBlankOrComment(line string) bool {
+	key, _ := lineKey(line)
+	return key == ""
+}
+
+// findServerBlock returns the lines [start, end) of the block of pattern, or
+// -1 if the file has no such block. A block ends at the next Server line.
+func findServerBlock(lines []string, pattern string) (int, int) {
+	start := -1
+	for i, line := range lines {
+		key, value := lineKey(line)
+		if key != "server" {
+			continue
+		}
+		if start >= 0 {
+			return start, i
+		}
+		if value == pattern {
+			start = i
+		}
+	}
+	return start, len(lines)
+}
+
+// AddServerConfig appends a Server block to the config file at path. It fails
+// if the file already defines a block with the same pattern.
+func AddServerConfig(path string, config ServerConfig) error {
+	if !serverPatternMatcher.MatchString(config.Pattern) {
+		return fmt.Errorf("invalid server pattern %q", config.Pattern)
+	}
+	return editConfigFile(path, func(lines []string) ([]string, error) {
+		if start, _ := findServerBlock(lines, config.Pattern); start >= 0 {
+			return nil, fmt.Errorf("%v:%d: server %v is already defined", path, start+1, config.Pattern)
+		}
+		if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) != "" {
+			lines = append(lines, "")
+		}
+		block := strings.TrimSuffix(FormatServerConfig(config), "\n")
+		return append(lines, strings.Split(block, "\n")...), nil
+	})
+}
+
+// findCurrentTarget returns the index and the value of the CurrentTarget line,
+// or -1 if the file has none
+func findCurrentTarget(lines []string) (int, string) {
+	for i, line := range lines {
+		key, value := lineKey(line)
+		if key == "server" {
+			break
+		}
+		if key == "currenttarget" {
+			return i, value
+		}
+	}
+	return -1, ""
+}
+
+// matchesServerBlock reports whether any Server line matches target
+func matchesServerBlock(lines []string, target string) bool {
+	for _, line := range lines {
+		if key, value := lineKey(line); key == "server" && MatchPattern(value, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveServerConfig deletes the Server block of pattern from the config file
+// at path. A CurrentTarget naming the pattern, or matched by it and by no
+// remaining block, is removed along with it, so that it does not silently
+// resolve differently; the removed target is returned.
+func RemoveServerConfig(path, pattern string) (string, error) {
+	var unset string
+	err := editConfigFile(path, func(lines []string) ([]string, error) {
+		start, end := findServerBlock(lines, pattern)
+		if start < 0 {
+			return nil, fmt.Errorf("server %v is not defined in %v", pattern, path)
+		}
+		// Trailing comments most likely describe the next block
+		for end > start+1 && isBlankOrComment(lines[end-1]) {
+			end--
+		}
+		// Avoid leaving two blank lines where the block was
+		for start > 0 && isBlank(lines[start-1]) && (end == len(lines) || isBlank(lines[end])) {
+			start--
+		}
+		// Nor a blank line at the top of the file
+		for start == 0 && end < len(lines) && isBlank(lines[end]) {
+			end++
+		}
+		lines = append(lines[:start:start], lines[end:]...)
+		i, target := findCurrentTarget(lines)
+		if i >= 0 && (target == pattern || MatchPattern(pattern, target) && !matchesServerBlock(lines, target)) {
+			unset = target
+			lines = removeCurrentTarget(lines, i)
+		}
+		return lines, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return unset, nil
+}
+
+// removeCurrentTarget deletes the CurrentTarget line at i, along with the
+// blank line separating it from the rest of the file
+func removeCurrentTarget(lines []string, i int) []string {
+	end := i + 1
+	if i == 0 && end < len(lines) && isBlank(lines[end]) {
+		end++
+	}
+	return append(lines[:i:i], lines[end:]...)
+}
+
+// SetCurrentTarget records the target used when none is given on the command
+// line, replacing any previous one; an empty target removes it
+func SetCurrentTarget(path, target string) error {
+	return editConfigFile(path, func(lines []string) ([]string, error) {
+		if i, _ := findCurrentTarget(lines); i >= 0 {
+			if target == "" {
+				return removeCurrentTarget(lines, i), nil
+			}
+			lines[i] = "CurrentTarget " + quoteConfigValue(target)
+			return lines, nil
+		}
+		if target == "" {
+			return lines, nil
+		}
+		// It must precede the first Server line to be a global setting
+		header := []string{"CurrentTarget " + quoteConfigValue(target)}
+		if len(lines) > 0 && !isBlank(lines[0]) {
+			header = append(header, "")
+		}
+		return append(header, lines...), nil
+	})
+}
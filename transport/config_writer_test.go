@@ -0,0 +1,233 @@
+package transport
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bytes)
+}
+
+func TestEditConfigFile(t *testing.T) {
+	appendLine := func(lines []string) ([]string, error) {
+		return append(lines, "Server added"), nil
+	}
+	for _, test := range []struct {
+		name    string
+		content string
+		edit    func(lines []string) ([]string, error)
+		want    string
+	}{
+		{name: "empty file", content: "", edit: appendLine, want: "Server added\n"},
+		{name: "adds the final newline", content: "Server a", edit: appendLine, want: "Server a\nServer added\n"},
+		{name: "keeps blank lines", content: "Server a\n\n", edit: appendLine, want: "Server a\n\nServer added\n"},
+		{
+			name:    "empty result",
+			content: "Server a\n",
+			edit:    func([]string) ([]string, error) { return nil, nil },
+			want:    "",
+		},
+		{
+			name:    "failed edit",
+			content: "Server a\n",
+			edit:    func([]string) ([]string, error) { return nil, fmt.Errorf("failed") },
+			want:    "Server a\n",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeConfigFiles(t, [2]string{"config", test.content})
+			err := editConfigFile(path, test.edit)
+			if _, failed := test.edit(nil); (err != nil) != (failed != nil) {
+				t.Errorf("editConfigFile() = %v, want %v", err, failed)
+			}
+			if got := readFile(t, path); got != test.want {
+				t.Errorf("content = %q, want %q", got, test.want)
+			}
+			// The temporary file is gone either way
+			entries, err := os.ReadDir(filepath.Dir(path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("directory has %v files, want only the config", len(entries))
+			}
+		})
+	}
+	t.Run("missing file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "nested", "config")
+		if err := editConfigFile(path, appendLine); err != nil {
+			t.Fatalf("editConfigFile() failed: %v", err)
+		}
+		if got := readFile(t, path); got != "Server added\n" {
+			t.Errorf("content = %q, want the added line", got)
+		}
+	})
+	t.Run("keeps the mode", func(t *testing.T) {
+		path := writeConfigFiles(t, [2]string{"config", "Server a\n"})
+		if err := os.Chmod(path, 0640); err != nil {
+			t.Fatal(err)
+		}
+		if err := editConfigFile(path, appendLine); err != nil {
+			t.Fatalf("editConfigFile() failed: %v", err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := info.Mode().Perm(); mode != 0640 {
+			t.Errorf("mode = %v, want %v", mode, os.FileMode(0640))
+		}
+	})
+}
+
+func TestAddServerConfig(t *testing.T) {
+	path := writeConfigFiles(t, [2]string{"config", "Server a\n  RealAddress a:1\n"})
+	config := withSet(ServerConfig{
+		Pattern:     "prod",
+		RealAddress: "prod.example.com:50051",
+		Security:    TypeInsecure,
+		Headers:     []Header{{"x-tag", "a # b"}},
+	}, "Security")
+	if err := AddServerConfig(path, config); err != nil {
+		t.Fatalf("AddServerConfig() failed: %v", err)
+	}
+	want := strings.Join([]string{
+		"Server a",
+		"  RealAddress a:1",
+		"",
+		"Server prod",
+		"  RealAddress prod.example.com:50051",
+		"  Security Insecure",
+		`  Header "x-tag: a # b"`,
+		"",
+	}, "\n")
+	if got := readFile(t, path); got != want {
+		t.Errorf("content = %q, want %q", got, want)
+	}
+	// The block reads back as written
+	configs, err := LoadServerConfigsFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := configs.Servers[1]; got.RealAddress != config.RealAddress || len(got.Headers) != 1 || got.Headers[0] != config.Headers[0] {
+		t.Errorf("read back %+v, want %+v", got, config)
+	}
+	if err := AddServerConfig(path, config); err == nil {
+		t.Error("AddServerConfig() of a defined server succeeded, want an error")
+	}
+	if err := AddServerConfig(path, ServerConfig{Pattern: "a b"}); err == nil {
+		t.Error("AddServerConfig() of an invalid pattern succeeded, want an error")
+	}
+}
+
+func TestRemoveServerConfig(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		pattern   string
+		content   string
+		want      string
+		wantUnset string
+		wantErr   bool
+	}{
+		{
+			name:    "middle block",
+			pattern: "b",
+			content: "Server a\n  RealAddress a:1\n\nServer b\n  RealAddress b:1\n\nServer c\n",
+			want:    "Server a\n  RealAddress a:1\n\nServer c\n",
+		},
+		{
+			name:    "last block",
+			pattern: "b",
+			content: "Server a\n\nServer b\n  RealAddress b:1\n",
+			want:    "Server a\n",
+		},
+		{
+			name:    "keeps the comments of the next block",
+			pattern: "a",
+			content: "Server a\n  RealAddress a:1\n\n# The c server\nServer c\n",
+			want:    "# The c server\nServer c\n",
+		},
+		{
+			name:      "unsets the current target",
+			pattern:   "prod",
+			content:   "CurrentTarget prod\n\nServer prod\n  RealAddress prod:1\n\nServer b\n",
+			want:      "Server b\n",
+			wantUnset: "prod",
+		},
+		{
+			name:      "unsets a current target matching the pattern",
+			pattern:   "prod-*",
+			content:   "CurrentTarget prod-1:50051\nServer prod-*\n  Security tls\nServer b\n",
+			want:      "Server b\n",
+			wantUnset: "prod-1:50051",
+		},
+		{
+			name:    "keeps a current target matching another block",
+			pattern: "prod-*",
+			content: "CurrentTarget prod-1\n\nServer prod-*\n  Security tls\n\nServer *\n  Security insecure\n",
+			want:    "CurrentTarget prod-1\n\nServer *\n  Security insecure\n",
+		},
+		{
+			name:    "keeps another current target",
+			pattern: "b",
+			content: "CurrentTarget a\n\nServer a\n\nServer b\n",
+			want:    "CurrentTarget a\n\nServer a\n",
+		},
+		{
+			name:    "undefined server",
+			pattern: "b",
+			content: "CurrentTarget b\n\nServer a\n",
+			want:    "CurrentTarget b\n\nServer a\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeConfigFiles(t, [2]string{"config", test.content})
+			unset, err := RemoveServerConfig(path, test.pattern)
+			if (err != nil) != test.wantErr {
+				t.Errorf("RemoveServerConfig() = %v, want an error: %v", err, test.wantErr)
+			}
+			if unset != test.wantUnset {
+				t.Errorf("RemoveServerConfig() unset %q, want %q", unset, test.wantUnset)
+			}
+			if got := readFile(t, path); got != test.want {
+				t.Errorf("content = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSetCurrentTarget(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		content string
+		target  string
+		want    string
+	}{
+		{name: "empty file", content: "", target: "a", want: "CurrentTarget a\n"},
+		{name: "before the first block", content: "Server a\n", target: "a", want: "CurrentTarget a\n\nServer a\n"},
+		{name: "replaces", content: "CurrentTarget a\n\nServer a\n", target: "b", want: "CurrentTarget b\n\nServer a\n"},
+		{name: "quotes", content: "", target: "a b", want: "CurrentTarget \"a b\"\n"},
+		{name: "unsets", content: "CurrentTarget a\n\nServer a\n", target: "", want: "Server a\n"},
+		{name: "unsets nothing", content: "Server a\n", target: "", want: "Server a\n"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeConfigFiles(t, [2]string{"config", test.content})
+			if err := SetCurrentTarget(path, test.target); err != nil {
+				t.Fatalf("SetCurrentTarget() failed: %v", err)
+			}
+			if got := readFile(t, path); got != test.want {
+				t.Errorf("content = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
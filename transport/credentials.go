@@ -0,0 +1,119 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"golang.org/x/oauth2/google"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/oauth"
+)
+
+// The OAuth2 scope requested for access tokens of Google APIs
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// tlsConfig builds the TLS settings shared by the TLS and GoogleDefault
+// security models: the root CAs, the optional client certificate for mutual
+// TLS, and the server name override.
+func tlsConfig(config ServerConfig) (*tls.Config, error) {
+	var roots *x509.CertPool
+	if config.UseSystemRoots {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load system root CAs: %v", err)
+		}
+		roots = pool
+	}
+	if config.IdentityFile != "" {
+		pem, err := os.ReadFile(config.IdentityFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %v", err)
+		}
+		if roots == nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA file %v", config.IdentityFile)
+		}
+	}
+	c := &tls.Config{RootCAs: roots, ServerName: config.ServerNameOverride}
+	if (config.CertificateFile == "") != (config.KeyFile == "") {
+		return nil, fmt.Errorf("mutual TLS requires both a certificate file and a key file")
+	}
+	if config.CertificateFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertificateFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
+
+// googleCredentials loads the per-RPC credentials of a Google credentials
+// file, or of the application default credentials if file is empty. Service
+// accounts sign JWT access tokens locally, without reaching a token endpoint;
+// other accounts, like authorized users, go through the OAuth2 token exchange.
+func googleCredentials(file string) (credentials.PerRPCCredentials, error) {
+	if file == "" {
+		return oauth.NewApplicationDefault(context.Background(), cloudPlatformScope)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var f struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse %v: %v", file, err)
+	}
+	if f.Type == "service_account" {
+		return oauth.NewJWTAccessFromKey(data)
+	}
+	creds, err := google.CredentialsFromJSON(context.Background(), data, cloudPlatformScope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %v: %v", file, err)
+	}
+	return oauth.TokenSource{TokenSource: creds.TokenSource}, nil
+}
+
+// credentialOptions translates the security model of config into dial options
+func credentialOptions(config ServerConfig) ([]grpc.DialOption, error) {
+	switch config.Security {
+	case TypeInsecure:
+		return []grpc.DialOption{grpc.WithInsecure()}, nil
+	case TypeTls:
+		if config.IdentityFile == "" && !config.UseSystemRoots {
+			return nil, fmt.Errorf("TLS requires a CA file, or trusting the system root CAs")
+		}
+		c, err := tlsConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create credential: %v", err)
+		}
+		return []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(c))}, nil
+	case TypeGoogleDefault:
+		// Google services are always trusted through the system roots, and a
+		// CA file can only add to them
+		config.UseSystemRoots = true
+		c, err := tlsConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create credential: %v", err)
+		}
+		adc, err := googleCredentials(config.GoogleCredentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load application default credentials: %v", err)
+		}
+		return []grpc.DialOption{
+			grpc.WithTransportCredentials(credentials.NewTLS(c)),
+			grpc.WithPerRPCCredentials(adc),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported security model: %v", config.Security)
+	}
+}
@@ -0,0 +1,177 @@
+package transport
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/oauth"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+// writeJSON writes v to a file in a test directory and returns its path
+func writeJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// startTLSServer serves the health service over TLS with a self-signed
+// certificate for "admin.test", recording the authorization header of each
+// call. It returns the address and the path of the CA file.
+func startTLSServer(t *testing.T, authorization chan<- string) (string, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "admin.test"},
+		DNSNames:              []string{"admin.test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	server := grpc.NewServer(
+		grpc.Creds(credentials.NewServerTLSFromCert(&cert)),
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			authorization <- strings.Join(md.Get("authorization"), ",")
+			return handler(ctx, req)
+		}),
+	)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	return lis.Addr().String(), caFile
+}
+
+func TestGoogleCredentialsServiceAccount(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	path := writeJSON(t, map[string]string{
+		"type":           "service_account",
+		"client_email":   "debug@example.iam.gserviceaccount.com",
+		"private_key_id": "key-1",
+		"private_key":    string(keyPEM),
+	})
+	authorization := make(chan string, 1)
+	address, caFile := startTLSServer(t, authorization)
+	// JWT access tokens are signed locally, so the whole exchange is offline
+	options, err := credentialOptions(ServerConfig{
+		Security:              TypeGoogleDefault,
+		IdentityFile:          caFile,
+		ServerNameOverride:    "admin.test",
+		GoogleCredentialsFile: path,
+	})
+	if err != nil {
+		t.Fatalf("credentialOptions() failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, address, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check() failed: %v", err)
+	}
+	header := <-authorization
+	parts := strings.Split(strings.TrimPrefix(header, "Bearer "), ".")
+	if !strings.HasPrefix(header, "Bearer ") || len(parts) != 3 {
+		t.Fatalf("authorization = %q, want a bearer JWT", header)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims struct {
+		Iss string `json:"iss"`
+		Aud string `json:"aud"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Iss != "debug@example.iam.gserviceaccount.com" || !strings.HasPrefix(claims.Aud, "https://admin.test") {
+		t.Errorf("claims = %+v, want the service account issuing for the server", claims)
+	}
+}
+
+func TestGoogleCredentialsAuthorizedUser(t *testing.T) {
+	path := writeJSON(t, map[string]string{
+		"type":          "authorized_user",
+		"client_id":     "id",
+		"client_secret": "secret",
+		"refresh_token": "refresh",
+	})
+	creds, err := googleCredentials(path)
+	if err != nil {
+		t.Fatalf("googleCredentials() failed: %v", err)
+	}
+	// The token exchange only happens on the first RPC
+	if _, ok := creds.(oauth.TokenSource); !ok {
+		t.Errorf("googleCredentials() = %T, want an oauth.TokenSource", creds)
+	}
+}
+
+func TestGoogleCredentialsErrors(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		path string
+	}{
+		{"missing file", filepath.Join(t.TempDir(), "missing.json")},
+		{"unknown type", writeJSON(t, map[string]string{"type": "external_account_v0"})},
+		{"not JSON", writeJSON(t, "not an object")},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := googleCredentials(test.path); err == nil {
+				t.Error("googleCredentials() succeeded, want an error")
+			}
+		})
+	}
+}
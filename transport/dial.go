@@ -0,0 +1,94 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	unixScheme         = "unix:"
+	unixAbstractScheme = "unix-abstract:"
+)
+
+// IsUnixTarget reports whether target names a Unix domain socket, either as
+// unix:path, unix:///absolute/path or unix-abstract:name
+func IsUnixTarget(target string) bool {
+	return strings.HasPrefix(target, unixScheme) || strings.HasPrefix(target, unixAbstractScheme)
+}
+
+// parseUnixTarget returns the socket address to dial for a Unix target. On
+// Linux, Go dials an abstract socket when the name starts with "@".
+func parseUnixTarget(target string) (string, error) {
+	var addr string
+	switch {
+	case strings.HasPrefix(target, unixAbstractScheme):
+		name := strings.TrimPrefix(target, unixAbstractScheme)
+		if name == "" {
+			return "", fmt.Errorf("empty abstract socket name in target %v", target)
+		}
+		addr = "@" + name
+	case strings.HasPrefix(target, unixScheme+"//"):
+		// unix://authority/path is not allowed, only unix:///absolute/path
+		rest := strings.TrimPrefix(target, unixScheme+"//")
+		if !strings.HasPrefix(rest, "/") {
+			return "", fmt.Errorf("invalid unix target %v, expect unix:///absolute/path", target)
+		}
+		addr = rest
+	default:
+		addr = strings.TrimPrefix(target, unixScheme)
+	}
+	if addr == "" {
+		return "", fmt.Errorf("empty socket path in target %v", target)
+	}
+	return addr, nil
+}
+
+// dialTarget returns the target to pass to grpc.Dial, and any extra options
+// needed to reach it. Unix targets and proxied targets are dialed with a
+// custom dialer, since gRPC cannot reach them on its own.
+func dialTarget(address string, config ServerConfig) (string, []grpc.DialOption, error) {
+	proxy := config.ProxyJump
+	if proxy == ProxyNone {
+		proxy = ""
+	}
+	var dialer dialFunc
+	var options []grpc.DialOption
+	switch {
+	case IsUnixTarget(address):
+		if proxy != "" {
+			return "", nil, fmt.Errorf("cannot reach unix target %v through proxy %v", address, proxy)
+		}
+		addr, err := parseUnixTarget(address)
+		if err != nil {
+			return "", nil, err
+		}
+		dialer = func(ctx context.Context, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", addr)
+		}
+		if config.ServerNameOverride == "" {
+			// Unix socket paths are not valid authorities
+			options = append(options, grpc.WithAuthority("localhost"))
+		}
+	case proxy != "":
+		// Let the proxy resolve the host, which may not be resolvable here
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return "", nil, fmt.Errorf("proxied target must be host:port, got %v", address)
+		}
+		proxyDial, err := proxyDialer(proxy)
+		if err != nil {
+			return "", nil, err
+		}
+		dialer = func(ctx context.Context, _ string) (net.Conn, error) {
+			return proxyDial(ctx, address)
+		}
+	default:
+		return address, nil, nil
+	}
+	options = append(options, grpc.WithContextDialer(dialer))
+	return "passthrough:///" + address, options, nil
+}
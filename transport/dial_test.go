@@ -0,0 +1,99 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestParseUnixTarget(t *testing.T) {
+	for _, test := range []struct {
+		target  string
+		want    string
+		wantErr bool
+	}{
+		{target: "unix:relative/path", want: "relative/path"},
+		{target: "unix:/absolute/path", want: "/absolute/path"},
+		{target: "unix:///absolute/path", want: "/absolute/path"},
+		{target: "unix-abstract:name", want: "@name"},
+		{target: "unix-abstract:", wantErr: true},
+		{target: "unix:", wantErr: true},
+		{target: "unix://", wantErr: true},
+		// Authorities are not supported
+		{target: "unix://host/path", wantErr: true},
+	} {
+		got, err := parseUnixTarget(test.target)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseUnixTarget(%q) error = %v, want an error: %v", test.target, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseUnixTarget(%q) = %q, want %q", test.target, got, test.want)
+		}
+	}
+}
+
+func TestDialTarget(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		address     string
+		config      ServerConfig
+		wantTarget  string
+		wantOptions int
+		wantErr     bool
+	}{
+		{name: "tcp", address: "localhost:50051", wantTarget: "localhost:50051"},
+		{name: "explicit proxy none", address: "localhost:50051", config: ServerConfig{ProxyJump: ProxyNone}, wantTarget: "localhost:50051"},
+		// A dialer, and an authority since the path is not a valid one
+		{name: "unix", address: "unix:///tmp/admin.sock", wantTarget: "passthrough:///unix:///tmp/admin.sock", wantOptions: 2},
+		{name: "unix with a server name", address: "unix-abstract:admin", config: ServerConfig{ServerNameOverride: "admin.test"}, wantTarget: "passthrough:///unix-abstract:admin", wantOptions: 1},
+		{name: "bad unix path", address: "unix://host/path", wantErr: true},
+		{name: "unix through a proxy", address: "unix:/tmp/admin.sock", config: ServerConfig{ProxyJump: "http://proxy:3128"}, wantErr: true},
+		{name: "proxied", address: "backend:50051", config: ServerConfig{ProxyJump: "http://proxy:3128"}, wantTarget: "passthrough:///backend:50051", wantOptions: 1},
+		{name: "proxied without a port", address: "backend", config: ServerConfig{ProxyJump: "http://proxy:3128"}, wantErr: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			target, options, err := dialTarget(test.address, test.config)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("dialTarget() error = %v, want an error: %v", err, test.wantErr)
+			}
+			if target != test.wantTarget || len(options) != test.wantOptions {
+				t.Errorf("dialTarget() = %q with %v options, want %q with %v", target, len(options), test.wantTarget, test.wantOptions)
+			}
+		})
+	}
+}
+
+func TestDialUnixTarget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admin.sock")
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(lis)
+	defer server.Stop()
+
+	target, options, err := dialTarget("unix://"+path, ServerConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, target, append(options, grpc.WithInsecure(), grpc.WithBlock())...)
+	if err != nil {
+		t.Fatalf("failed to dial %v: %v", target, err)
+	}
+	defer conn.Close()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("Check() = %v, %v, want SERVING", resp, err)
+	}
+}
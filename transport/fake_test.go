@@ -0,0 +1,195 @@
+package transport
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"google.golang.org/grpc"
+	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeChannelz serves channelz entities from memory, ordered by ID like a
+// real server, and records the RPCs it receives
+type fakeChannelz struct {
+	zpb.ChannelzClient
+	channels      map[int64]*zpb.Channel
+	subchannels   map[int64]*zpb.Subchannel
+	sockets       map[int64]*zpb.Socket
+	servers       map[int64]*zpb.Server
+	serverSockets map[int64][]*zpb.SocketRef
+	// The page size used when the request leaves it to the server
+	defaultPageSize int
+	// Called at the start of every RPC with its name; an error fails the RPC
+	intercept func(ctx context.Context, method string) error
+
+	mu    sync.Mutex
+	calls map[string]int
+	// The pages requested, as the start IDs of each list RPC
+	starts []int64
+}
+
+func newFakeChannelz() *fakeChannelz {
+	return &fakeChannelz{
+		channels:        make(map[int64]*zpb.Channel),
+		subchannels:     make(map[int64]*zpb.Subchannel),
+		sockets:         make(map[int64]*zpb.Socket),
+		servers:         make(map[int64]*zpb.Server),
+		serverSockets:   make(map[int64][]*zpb.SocketRef),
+		defaultPageSize: 100,
+		calls:           make(map[string]int),
+	}
+}
+
+func (f *fakeChannelz) record(ctx context.Context, method string) error {
+	f.mu.Lock()
+	f.calls[method]++
+	f.mu.Unlock()
+	if f.intercept != nil {
+		return f.intercept(ctx, method)
+	}
+	return nil
+}
+
+func (f *fakeChannelz) callCount(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[method]
+}
+
+// addChannel adds a channel with the given children
+func (f *fakeChannelz) addChannel(id int64, channelIDs, subchannelIDs []int64) {
+	channel := &zpb.Channel{Ref: &zpb.ChannelRef{ChannelId: id}, Data: &zpb.ChannelData{}}
+	for _, child := range channelIDs {
+		channel.ChannelRef = append(channel.ChannelRef, &zpb.ChannelRef{ChannelId: child})
+	}
+	for _, child := range subchannelIDs {
+		channel.SubchannelRef = append(channel.SubchannelRef, &zpb.SubchannelRef{SubchannelId: child})
+	}
+	f.channels[id] = channel
+}
+
+// addSubchannel adds a subchannel with the given children
+func (f *fakeChannelz) addSubchannel(id int64, channelIDs, subchannelIDs, socketIDs []int64) {
+	subchannel := &zpb.Subchannel{Ref: &zpb.SubchannelRef{SubchannelId: id}, Data: &zpb.ChannelData{}}
+	for _, child := range channelIDs {
+		subchannel.ChannelRef = append(subchannel.ChannelRef, &zpb.ChannelRef{ChannelId: child})
+	}
+	for _, child := range subchannelIDs {
+		subchannel.SubchannelRef = append(subchannel.SubchannelRef, &zpb.SubchannelRef{SubchannelId: child})
+	}
+	for _, child := range socketIDs {
+		subchannel.SocketRef = append(subchannel.SocketRef, &zpb.SocketRef{SocketId: child})
+		f.sockets[child] = &zpb.Socket{Ref: &zpb.SocketRef{SocketId: child}}
+	}
+	f.subchannels[id] = subchannel
+}
+
+// page returns the sorted IDs of ids from start on, at most max of them, and
+// whether they are the last ones
+func (f *fakeChannelz) page(ids []int64, start, max int64) ([]int64, bool) {
+	if max <= 0 {
+		max = int64(f.defaultPageSize)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var rest []int64
+	for _, id := range ids {
+		if id >= start {
+			rest = append(rest, id)
+		}
+	}
+	if int64(len(rest)) > max {
+		return rest[:max], false
+	}
+	return rest, true
+}
+
+func (f *fakeChannelz) GetTopChannels(ctx context.Context, in *zpb.GetTopChannelsRequest, opts ...grpc.CallOption) (*zpb.GetTopChannelsResponse, error) {
+	if err := f.record(ctx, "GetTopChannels"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	f.starts = append(f.starts, in.StartChannelId)
+	f.mu.Unlock()
+	var ids []int64
+	for id := range f.channels {
+		ids = append(ids, id)
+	}
+	page, end := f.page(ids, in.StartChannelId, in.MaxResults)
+	resp := &zpb.GetTopChannelsResponse{End: end}
+	for _, id := range page {
+		resp.Channel = append(resp.Channel, f.channels[id])
+	}
+	return resp, nil
+}
+
+func (f *fakeChannelz) GetServers(ctx context.Context, in *zpb.GetServersRequest, opts ...grpc.CallOption) (*zpb.GetServersResponse, error) {
+	if err := f.record(ctx, "GetServers"); err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for id := range f.servers {
+		ids = append(ids, id)
+	}
+	page, end := f.page(ids, in.StartServerId, in.MaxResults)
+	resp := &zpb.GetServersResponse{End: end}
+	for _, id := range page {
+		resp.Server = append(resp.Server, f.servers[id])
+	}
+	return resp, nil
+}
+
+func (f *fakeChannelz) GetServerSockets(ctx context.Context, in *zpb.GetServerSocketsRequest, opts ...grpc.CallOption) (*zpb.GetServerSocketsResponse, error) {
+	if err := f.record(ctx, "GetServerSockets"); err != nil {
+		return nil, err
+	}
+	refs, ok := f.serverSockets[in.ServerId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no server %v", in.ServerId)
+	}
+	var ids []int64
+	for _, ref := range refs {
+		ids = append(ids, ref.SocketId)
+	}
+	page, end := f.page(ids, in.StartSocketId, in.MaxResults)
+	resp := &zpb.GetServerSocketsResponse{End: end}
+	for _, id := range page {
+		resp.SocketRef = append(resp.SocketRef, &zpb.SocketRef{SocketId: id})
+	}
+	return resp, nil
+}
+
+func (f *fakeChannelz) GetChannel(ctx context.Context, in *zpb.GetChannelRequest, opts ...grpc.CallOption) (*zpb.GetChannelResponse, error) {
+	if err := f.record(ctx, "GetChannel"); err != nil {
+		return nil, err
+	}
+	channel, ok := f.channels[in.ChannelId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no channel %v", in.ChannelId)
+	}
+	return &zpb.GetChannelResponse{Channel: channel}, nil
+}
+
+func (f *fakeChannelz) GetSubchannel(ctx context.Context, in *zpb.GetSubchannelRequest, opts ...grpc.CallOption) (*zpb.GetSubchannelResponse, error) {
+	if err := f.record(ctx, "GetSubchannel"); err != nil {
+		return nil, err
+	}
+	subchannel, ok := f.subchannels[in.SubchannelId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no subchannel %v", in.SubchannelId)
+	}
+	return &zpb.GetSubchannelResponse{Subchannel: subchannel}, nil
+}
+
+func (f *fakeChannelz) GetSocket(ctx context.Context, in *zpb.GetSocketRequest, opts ...grpc.CallOption) (*zpb.GetSocketResponse, error) {
+	if err := f.record(ctx, "GetSocket"); err != nil {
+		return nil, err
+	}
+	socket, ok := f.sockets[in.SocketId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no socket %v", in.SocketId)
+	}
+	return &zpb.GetSocketResponse{Socket: socket}, nil
+}
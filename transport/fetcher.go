@@ -0,0 +1,242 @@
+package transport
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	timestamppb "github.com/golang/protobuf/ptypes/timestamp"
+	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+)
+
+// DefaultConcurrency is how many channelz RPCs the Fetchers of a client issue
+// at once, unless WithConcurrency says otherwise.
+const DefaultConcurrency = 16
+
+// WithConcurrency caps how many RPCs the Fetchers of the client have in
+// flight at once, all of them together. Values below 1 mean
+// DefaultConcurrency.
+func WithConcurrency(concurrency int) ClientOption {
+	return func(c *Client) {
+		c.concurrency = concurrency
+	}
+}
+
+// fetchResult is a fetch that is in flight or done. Waiters block on done,
+// then read value and err.
+type fetchResult struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// Fetcher fetches channelz entities concurrently, at most once each. It
+// caches every channel, subchannel, socket and server socket listing by ID,
+// so it is meant to live as long as one invocation: results are never
+// refreshed. It is safe for concurrent use.
+type Fetcher struct {
+	client      *Client
+	mu          sync.Mutex
+	channels    map[int64]*fetchResult
+	subchannels map[int64]*fetchResult
+	sockets     map[int64]*fetchResult
+	serverRefs  map[int64]*fetchResult
+}
+
+// NewFetcher returns a Fetcher with an empty cache
+func (c *Client) NewFetcher() *Fetcher {
+	return &Fetcher{
+		client:      c,
+		channels:    make(map[int64]*fetchResult),
+		subchannels: make(map[int64]*fetchResult),
+		sockets:     make(map[int64]*fetchResult),
+		serverRefs:  make(map[int64]*fetchResult),
+	}
+}
+
+// fetch returns the cached result for id, or runs rpc to fill it. Concurrent
+// callers asking for the same id wait for the first one instead of issuing
+// their own RPC. Waiting for a free slot stops when ctx is done.
+func (f *Fetcher) fetch(ctx context.Context, cache map[int64]*fetchResult, id int64, rpc func() (interface{}, error)) (interface{}, error) {
+	f.mu.Lock()
+	if result, ok := cache[id]; ok {
+		f.mu.Unlock()
+		<-result.done
+		return result.value, result.err
+	}
+	result := &fetchResult{done: make(chan struct{})}
+	cache[id] = result
+	f.mu.Unlock()
+	defer close(result.done)
+	select {
+	case f.client.semaphore <- struct{}{}:
+	case <-ctx.Done():
+		result.err = ctx.Err()
+		return nil, result.err
+	}
+	result.value, result.err = rpc()
+	<-f.client.semaphore
+	return result.value, result.err
+}
+
+// Channel returns the queried channel
+func (f *Fetcher) Channel(ctx context.Context, channelID int64) (*zpb.Channel, error) {
+	value, err := f.fetch(ctx, f.channels, channelID, func() (interface{}, error) {
+		return f.client.Channel(ctx, channelID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*zpb.Channel), nil
+}
+
+// Subchannel returns the queried subchannel
+func (f *Fetcher) Subchannel(ctx context.Context, subchannelID int64) (*zpb.Subchannel, error) {
+	value, err := f.fetch(ctx, f.subchannels, subchannelID, func() (interface{}, error) {
+		return f.client.Subchannel(ctx, subchannelID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*zpb.Subchannel), nil
+}
+
+// Socket returns the queried socket
+func (f *Fetcher) Socket(ctx context.Context, socketID int64) (*zpb.Socket, error) {
+	value, err := f.fetch(ctx, f.sockets, socketID, func() (interface{}, error) {
+		return f.client.Socket(ctx, socketID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*zpb.Socket), nil
+}
+
+// ServerSocketRefs returns the references of all sockets of the server
+func (f *Fetcher) ServerSocketRefs(ctx context.Context, serverID int64) ([]*zpb.SocketRef, error) {
+	value, err := f.fetch(ctx, f.serverRefs, serverID, func() (interface{}, error) {
+		return f.client.ServerSocketRefs(ctx, serverID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]*zpb.SocketRef), nil
+}
+
+// forEach calls fn for every index below n concurrently, and waits for all of
+// them. The semaphore of the client, not forEach, bounds how many RPCs are in
+// flight.
+func forEach(n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// TimeOf converts a channelz or CSDS timestamp, returning the zero time when
+// it is unset or invalid
+func TimeOf(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	t, err := ptypes.Timestamp(ts)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// Channels fetches the referenced channels concurrently. The results and
+// errors are indexed like refs.
+func (f *Fetcher) Channels(ctx context.Context, refs []*zpb.ChannelRef) ([]*zpb.Channel, []error) {
+	channels := make([]*zpb.Channel, len(refs))
+	errs := make([]error, len(refs))
+	forEach(len(refs), func(i int) {
+		channels[i], errs[i] = f.Channel(ctx, refs[i].ChannelId)
+	})
+	return channels, errs
+}
+
+// Subchannels fetches the referenced subchannels concurrently. The results
+// and errors are indexed like refs.
+func (f *Fetcher) Subchannels(ctx context.Context, refs []*zpb.SubchannelRef) ([]*zpb.Subchannel, []error) {
+	subchannels := make([]*zpb.Subchannel, len(refs))
+	errs := make([]error, len(refs))
+	forEach(len(refs), func(i int) {
+		subchannels[i], errs[i] = f.Subchannel(ctx, refs[i].SubchannelId)
+	})
+	return subchannels, errs
+}
+
+// Sockets fetches the referenced sockets concurrently. The results and errors
+// are indexed like refs.
+func (f *Fetcher) Sockets(ctx context.Context, refs []*zpb.SocketRef) ([]*zpb.Socket, []error) {
+	sockets := make([]*zpb.Socket, len(refs))
+	errs := make([]error, len(refs))
+	forEach(len(refs), func(i int) {
+		sockets[i], errs[i] = f.Socket(ctx, refs[i].SocketId)
+	})
+	return sockets, errs
+}
+
+// ServersSocketRefs lists the sockets of the servers concurrently. The
+// results and errors are indexed like servers.
+func (f *Fetcher) ServersSocketRefs(ctx context.Context, servers []*zpb.Server) ([][]*zpb.SocketRef, []error) {
+	refs := make([][]*zpb.SocketRef, len(servers))
+	errs := make([]error, len(servers))
+	forEach(len(servers), func(i int) {
+		refs[i], errs[i] = f.ServerSocketRefs(ctx, servers[i].Ref.ServerId)
+	})
+	return refs, errs
+}
+
+// subchannelsOf fetches the subchannels of the channels, each once. The ones
+// that failed are skipped, and the first error is returned.
+func (f *Fetcher) subchannelsOf(ctx context.Context, channels []*zpb.Channel) ([]*zpb.Subchannel, error) {
+	var refs []*zpb.SubchannelRef
+	seen := make(map[int64]bool)
+	for _, channel := range channels {
+		for _, ref := range channel.SubchannelRef {
+			if !seen[ref.SubchannelId] {
+				seen[ref.SubchannelId] = true
+				refs = append(refs, ref)
+			}
+		}
+	}
+	subchannels, errs := f.Subchannels(ctx, refs)
+	var result []*zpb.Subchannel
+	var firstErr error
+	for i, subchannel := range subchannels {
+		if errs[i] != nil {
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			continue
+		}
+		result = append(result, subchannel)
+	}
+	return result, firstErr
+}
+
+// compact drops the sockets that failed to be fetched, and returns the first
+// error.
+func compact(sockets []*zpb.Socket, errs []error) ([]*zpb.Socket, error) {
+	var result []*zpb.Socket
+	var firstErr error
+	for i, socket := range sockets {
+		if errs[i] != nil {
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			continue
+		}
+		result = append(result, socket)
+	}
+	return result, firstErr
+}
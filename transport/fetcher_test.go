@@ -0,0 +1,104 @@
+package transport
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestFetcherCache(t *testing.T) {
+	fake := newFakeChannelz()
+	fake.addChannel(1, nil, nil)
+	f := NewClientFromStubs(fake, nil, nil).NewFetcher()
+	ctx := context.Background()
+	refs := []*zpb.ChannelRef{{ChannelId: 1}, {ChannelId: 1}, {ChannelId: 2}, {ChannelId: 1}}
+	channels, errs := f.Channels(ctx, refs)
+	for i, ref := range refs {
+		if ref.ChannelId == 1 && (errs[i] != nil || channels[i].GetRef().GetChannelId() != 1) {
+			t.Errorf("Channels()[%v] = %v, %v, want channel 1", i, channels[i], errs[i])
+		}
+		if ref.ChannelId == 2 && status.Code(errs[i]) != codes.NotFound {
+			t.Errorf("Channels()[%v] = %v, want NotFound", i, errs[i])
+		}
+	}
+	// Failures are cached too
+	if _, err := f.Channel(ctx, 2); status.Code(err) != codes.NotFound {
+		t.Errorf("Channel(2) = %v, want NotFound", err)
+	}
+	if calls := fake.callCount("GetChannel"); calls != 2 {
+		t.Errorf("GetChannel called %v times, want once per channel", calls)
+	}
+	// A new Fetcher starts over
+	if _, err := NewClientFromStubs(fake, nil, nil).NewFetcher().Channel(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if calls := fake.callCount("GetChannel"); calls != 3 {
+		t.Errorf("GetChannel called %v times, want 3", calls)
+	}
+}
+
+func TestFetcherConcurrency(t *testing.T) {
+	const concurrency = 3
+	fake := newFakeChannelz()
+	var refs []*zpb.SocketRef
+	for id := int64(1); id <= 20; id++ {
+		fake.sockets[id] = &zpb.Socket{Ref: &zpb.SocketRef{SocketId: id}}
+		refs = append(refs, &zpb.SocketRef{SocketId: id})
+	}
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	fake.intercept = func(ctx context.Context, method string) error {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return nil
+	}
+	// The cap is shared by all the Fetchers of the client
+	client := NewClientFromStubs(fake, nil, nil, WithConcurrency(concurrency))
+	var wg sync.WaitGroup
+	for n := 0; n < 2; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sockets, errs := client.NewFetcher().Sockets(context.Background(), refs)
+			for i := range refs {
+				if errs[i] != nil || sockets[i].GetRef().GetSocketId() != refs[i].SocketId {
+					t.Errorf("Sockets()[%v] = %v, %v, want socket %v", i, sockets[i], errs[i], refs[i].SocketId)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if maxInFlight != concurrency {
+		t.Errorf("%v RPCs were in flight at once, want %v", maxInFlight, concurrency)
+	}
+}
+
+func TestFetcherCanceledWhileWaiting(t *testing.T) {
+	fake := newFakeChannelz()
+	fake.addChannel(1, nil, nil)
+	client := NewClientFromStubs(fake, nil, nil, WithConcurrency(1))
+	// Take the only slot, as a slow RPC of another Fetcher would
+	client.semaphore <- struct{}{}
+	defer func() { <-client.semaphore }()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.NewFetcher().Channel(ctx, 1); err != context.Canceled {
+		t.Errorf("Channel() = %v, want %v", err, context.Canceled)
+	}
+	if calls := fake.callCount("GetChannel"); calls != 0 {
+		t.Errorf("GetChannel called %v times, want none", calls)
+	}
+}
@@ -2,156 +2,286 @@ package transport
 
 import (
 	"context"
-	"log"
+	"fmt"
 	"time"
 
 	csdspb "github.com/envoyproxy/go-control-plane/envoy/service/status/v3"
 	"google.golang.org/grpc"
 	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/connectivity"
-	"google.golang.org/grpc/credentials"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
 )
 
-var conn *grpc.ClientConn
-var channelzClient zpb.ChannelzClient
-var csdsClient csdspb.ClientStatusDiscoveryServiceClient
-var healthClient healthpb.HealthClient
-
-// Connect connects to the service at address and creates stubs
-func Connect(address, certFile, serverNameOverride string) {
-	var err error
-	var credOption grpc.DialOption
-	if certFile != "" {
-		cred, err := credentials.NewClientTLSFromFile(certFile, serverNameOverride)
-		if err != nil {
-			log.Fatalf("failed to create credential: %v", err)
-		}
-		credOption = grpc.WithTransportCredentials(cred)
-	} else {
-		credOption = grpc.WithInsecure()
+// Client talks to the admin services of one target. It owns the connection
+// and the stubs, and is safe for concurrent use.
+type Client struct {
+	conn        *grpc.ClientConn
+	channelz    zpb.ChannelzClient
+	csds        csdspb.ClientStatusDiscoveryServiceClient
+	health      healthpb.HealthClient
+	policy      callPolicy
+	pageSize    int64
+	resultLimit int
+	concurrency int
+	// Shared by every Fetcher of the client, to bound the RPCs in flight
+	semaphore chan struct{}
+}
+
+// ClientOption configures how a Client issues its RPCs
+type ClientOption func(*Client)
+
+// WithPagination sets the page size of the channelz list RPCs, and caps how
+// many entities each iterator yields in total. 0 means the server decides,
+// and unlimited, respectively.
+func WithPagination(maxResults int64, limit int) ClientOption {
+	return func(c *Client) {
+		c.pageSize = maxResults
+		c.resultLimit = limit
+	}
+}
+
+// WithCallPolicy sets the deadline and the number of retries applied to every
+// unary admin RPC
+func WithCallPolicy(timeout time.Duration, retries int) ClientOption {
+	return func(c *Client) {
+		c.policy = callPolicy{timeout: timeout, maxRetries: retries}
+	}
+}
+
+// rpcError annotates a failed RPC with the entity being fetched, while keeping
+// the original gRPC status reachable through status.FromError and status.Code.
+type rpcError struct {
+	msg string
+	err error
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("%v: %v", e.msg, e.err)
+}
+
+func (e *rpcError) Unwrap() error {
+	return e.err
+}
+
+func (e *rpcError) GRPCStatus() *status.Status {
+	return status.Convert(e.err)
+}
+
+func wrapRPCError(err error, format string, a ...interface{}) error {
+	return &rpcError{msg: fmt.Sprintf(format, a...), err: err}
+}
+
+// newClient returns a Client without stubs, configured by the options
+func newClient(clientOptions []ClientOption) *Client {
+	c := &Client{}
+	for _, option := range clientOptions {
+		option(c)
+	}
+	if c.concurrency < 1 {
+		c.concurrency = DefaultConcurrency
+	}
+	c.semaphore = make(chan struct{}, c.concurrency)
+	return c
+}
+
+// NewClient connects to the service described by the resolved config, and
+// creates stubs. It waits until the connection is ready, or ctx is done.
+func NewClient(ctx context.Context, config ServerConfig, clientOptions ...ClientOption) (*Client, error) {
+	c := newClient(clientOptions)
+	address := config.DialAddress()
+	options, err := credentialOptions(config)
+	if err != nil {
+		return nil, err
+	}
+	md, err := newMetadataCredentials(config.Headers, config.TokenFile)
+	if err != nil {
+		return nil, err
+	}
+	if md != nil {
+		options = append(options, grpc.WithPerRPCCredentials(md))
+	}
+	options = append(options, grpc.WithUnaryInterceptor(c.policy.intercept))
+	target, targetOptions, err := dialTarget(address, config)
+	if err != nil {
+		return nil, err
 	}
+	options = append(options, targetOptions...)
 	// Dial
-	conn, err = grpc.Dial(address, credOption)
+	conn, err := grpc.Dial(target, options...)
 	if err != nil {
-		log.Fatalf("failed to connect: %v", err)
+		return nil, fmt.Errorf("failed to connect: %v", err)
 	}
-	channelzClient = zpb.NewChannelzClient(conn)
-	csdsClient = csdspb.NewClientStatusDiscoveryServiceClient(conn)
-	healthClient = healthpb.NewHealthClient(conn)
+	c.conn = conn
+	c.channelz = zpb.NewChannelzClient(conn)
+	c.csds = csdspb.NewClientStatusDiscoveryServiceClient(conn)
+	c.health = healthpb.NewHealthClient(conn)
 	// Wait for ready
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
 	var state connectivity.State = conn.GetState()
 	for state != connectivity.Ready {
 		conn.WaitForStateChange(ctx, state)
 		if ctx.Err() != nil {
-			log.Fatalf("failed to establish connection to address: %v", address)
+			conn.Close()
+			if ctx.Err() == context.Canceled {
+				return nil, status.Errorf(codes.Canceled, "canceled while connecting to address: %v", address)
+			}
+			return nil, status.Errorf(codes.DeadlineExceeded, "failed to establish connection to address: %v", address)
 		}
 		state = conn.GetState()
 	}
+	return c, nil
+}
+
+// NewClientFromStubs returns a Client backed by the given stubs instead of a
+// connection, for instance fakes in tests. The call policy applies to the
+// stubs as it would to a connection.
+func NewClientFromStubs(channelz zpb.ChannelzClient, csds csdspb.ClientStatusDiscoveryServiceClient, health healthpb.HealthClient, clientOptions ...ClientOption) *Client {
+	c := newClient(clientOptions)
+	c.channelz = policyChannelz{ChannelzClient: channelz, policy: c.policy}
+	c.csds = policyCSDS{ClientStatusDiscoveryServiceClient: csds, policy: c.policy}
+	c.health = policyHealth{HealthClient: health, policy: c.policy}
+	return c
+}
+
+// Close releases the connection. The Client must not be used afterwards.
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// IsConnected checks if the connection is ready to use. Clients backed by
+// stubs are always connected.
+func (c *Client) IsConnected() bool {
+	if c.conn == nil {
+		return true
+	}
+	return c.conn.GetState() == connectivity.Ready
 }
 
-// IsConnected checks if the connection is ready to use
-func IsConnected() bool {
-	if conn == nil {
-		return false
+// Channels returns all available channels, paging through the results
+func (c *Client) Channels(ctx context.Context) ([]*zpb.Channel, error) {
+	var channels []*zpb.Channel
+	it := c.NewChannelIterator(ctx)
+	for it.Next() {
+		channels = append(channels, it.Channel())
 	}
-	return conn.GetState() == connectivity.Ready
+	return channels, it.Err()
 }
 
-// Channels returns all available channels
-func Channels() []*zpb.Channel {
-	channels, err := channelzClient.GetTopChannels(context.Background(), &zpb.GetTopChannelsRequest{})
+// Channel returns the queried channel
+func (c *Client) Channel(ctx context.Context, channelID int64) (*zpb.Channel, error) {
+	channel, err := c.channelz.GetChannel(ctx, &zpb.GetChannelRequest{ChannelId: channelID})
 	if err != nil {
-		log.Fatalf("failed to fetch top channels: %v", err)
+		return nil, wrapRPCError(err, "failed to fetch channel (id=%v)", channelID)
 	}
-	return channels.Channel
+	return channel.Channel, nil
 }
 
 // Subchannel returns the queried subchannel
-func Subchannel(subchannelID int64) *zpb.Subchannel {
-	subchannel, err := channelzClient.GetSubchannel(context.Background(), &zpb.GetSubchannelRequest{SubchannelId: subchannelID})
+func (c *Client) Subchannel(ctx context.Context, subchannelID int64) (*zpb.Subchannel, error) {
+	subchannel, err := c.channelz.GetSubchannel(ctx, &zpb.GetSubchannelRequest{SubchannelId: subchannelID})
 	if err != nil {
-		log.Fatalf("failed to fetch subchannel (id=%v): %v", subchannelID, err)
+		return nil, wrapRPCError(err, "failed to fetch subchannel (id=%v)", subchannelID)
 	}
-	return subchannel.Subchannel
+	return subchannel.Subchannel, nil
 }
 
-// Subchannels traverses all channels and fetches all subchannels
-func Subchannels() []*zpb.Subchannel {
-	var s []*zpb.Subchannel
-	for _, channel := range Channels() {
-		for _, subchannelRef := range channel.SubchannelRef {
-			s = append(s, Subchannel(subchannelRef.SubchannelId))
-		}
+// Subchannels traverses all channels and fetches all subchannels. Subchannels
+// that fail to be fetched are skipped, and the first such error is returned
+// alongside the ones that succeeded.
+func (c *Client) Subchannels(ctx context.Context) ([]*zpb.Subchannel, error) {
+	channels, err := c.Channels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.NewFetcher().subchannelsOf(ctx, channels)
+}
+
+// Servers returns all available servers, paging through the results
+func (c *Client) Servers(ctx context.Context) ([]*zpb.Server, error) {
+	var servers []*zpb.Server
+	it := c.NewServerIterator(ctx)
+	for it.Next() {
+		servers = append(servers, it.Server())
 	}
-	return s
+	return servers, it.Err()
 }
 
-// Servers returns all available servers
-func Servers() []*zpb.Server {
-	servers, err := channelzClient.GetServers(context.Background(), &zpb.GetServersRequest{})
+// Server returns the queried server
+func (c *Client) Server(ctx context.Context, serverID int64) (*zpb.Server, error) {
+	server, err := c.channelz.GetServer(ctx, &zpb.GetServerRequest{ServerId: serverID})
 	if err != nil {
-		log.Fatalf("failed to fetch servers: %v", err)
+		return nil, wrapRPCError(err, "failed to fetch server (id=%v)", serverID)
 	}
-	return servers.Server
+	return server.Server, nil
 }
 
 // Socket returns a socket
-func Socket(socketID int64) *zpb.Socket {
-	socket, err := channelzClient.GetSocket(context.Background(), &zpb.GetSocketRequest{SocketId: socketID})
+func (c *Client) Socket(ctx context.Context, socketID int64) (*zpb.Socket, error) {
+	socket, err := c.channelz.GetSocket(ctx, &zpb.GetSocketRequest{SocketId: socketID})
 	if err != nil {
-		log.Fatalf("failed to fetch socket (id=%v): %v", socketID, err)
+		return nil, wrapRPCError(err, "failed to fetch socket (id=%v)", socketID)
 	}
-	return socket.Socket
+	return socket.Socket, nil
 }
 
-// ServerSocket returns all sockets of this server
-func ServerSocket(serverId int64) []*zpb.Socket {
-	var s []*zpb.Socket
-	serverSocketResp, err := channelzClient.GetServerSockets(
-		context.Background(),
-		&zpb.GetServerSocketsRequest{ServerId: serverId},
-	)
-	if err != nil {
-		log.Fatalf("failed to fetch server sockets (id=%v): %v", serverId, err)
+// ServerSocketRefs returns the references of all sockets of this server,
+// paging through the results
+func (c *Client) ServerSocketRefs(ctx context.Context, serverID int64) ([]*zpb.SocketRef, error) {
+	var socketRefs []*zpb.SocketRef
+	it := c.NewServerSocketIterator(ctx, serverID)
+	for it.Next() {
+		socketRefs = append(socketRefs, it.SocketRef())
 	}
-	for _, socketRef := range serverSocketResp.SocketRef {
-		s = append(s, Socket(socketRef.SocketId))
+	return socketRefs, it.Err()
+}
+
+// ServerSocket returns all sockets of this server. Sockets that fail to be
+// fetched are skipped, and the first such error is returned alongside the
+// ones that succeeded.
+func (c *Client) ServerSocket(ctx context.Context, serverID int64) ([]*zpb.Socket, error) {
+	socketRefs, err := c.ServerSocketRefs(ctx, serverID)
+	if err != nil {
+		return nil, err
 	}
-	return s
+	sockets, errs := c.NewFetcher().Sockets(ctx, socketRefs)
+	return compact(sockets, errs)
 }
 
-// ServerSockets returns all sockets for servers
-func Sockets() []*zpb.Socket {
-	var s []*zpb.Socket
-	// Gather client sockets
-	for _, subchannel := range Subchannels() {
-		for _, socketRef := range subchannel.SocketRef {
-			s = append(s, Socket(socketRef.SocketId))
+// Sockets returns all sockets for both subchannels and servers. Like
+// Subchannels, it returns whatever could be fetched plus the first error.
+func (c *Client) Sockets(ctx context.Context) ([]*zpb.Socket, error) {
+	entries, firstErr := c.NewFetcher().AllSockets(ctx)
+	var sockets []*zpb.Socket
+	for _, entry := range entries {
+		if entry.Err != nil {
+			if firstErr == nil {
+				firstErr = entry.Err
+			}
+			continue
 		}
+		sockets = append(sockets, entry.Socket)
 	}
-	// Gather server sockets
-	for _, server := range Servers() {
-		s = append(s, ServerSocket(server.Ref.ServerId)...)
-	}
-	return s
+	return sockets, firstErr
 }
 
 // FetchClientStatus fetches the xDS resources status
-func FetchClientStatus() *csdspb.ClientStatusResponse {
-	resp, err := csdsClient.FetchClientStatus(context.Background(), &csdspb.ClientStatusRequest{})
+func (c *Client) FetchClientStatus(ctx context.Context) (*csdspb.ClientStatusResponse, error) {
+	resp, err := c.csds.FetchClientStatus(ctx, &csdspb.ClientStatusRequest{})
 	if err != nil {
-		log.Fatalf("failed to fetch xds config: %v", err)
+		return nil, wrapRPCError(err, "failed to fetch xds config")
 	}
-	return resp
+	return resp, nil
 }
 
-func GetHealthStatus(service string) string {
-	resp, err := healthClient.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+// GetHealthStatus returns the serving status of the given service
+func (c *Client) GetHealthStatus(ctx context.Context, service string) (string, error) {
+	resp, err := c.health.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
 	if err != nil {
-		log.Fatalf("failed to fetch health status for \"%s\": %v", service, err)
+		return "", wrapRPCError(err, "failed to fetch health status for \"%s\"", service)
 	}
-	return healthpb.HealthCheckResponse_ServingStatus_name[int32(resp.Status)]
+	return healthpb.HealthCheckResponse_ServingStatus_name[int32(resp.Status)], nil
 }
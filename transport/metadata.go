@@ -0,0 +1,76 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Header is a metadata entry attached to every admin RPC
+type Header struct {
+	Key   string
+	Value string
+}
+
+// ParseHeader parses a "key:value" header, as given to -H or in the config
+// file. Keys are lowercased, as gRPC metadata keys are case insensitive.
+func ParseHeader(x string) (Header, error) {
+	i := strings.Index(x, ":")
+	if i <= 0 {
+		return Header{}, fmt.Errorf("Invalid header, expect key:value: %v", x)
+	}
+	key := strings.ToLower(strings.TrimSpace(x[:i]))
+	if key == "" || strings.HasPrefix(key, "grpc-") {
+		return Header{}, fmt.Errorf("Invalid header key: %v", x[:i])
+	}
+	return Header{Key: key, Value: strings.TrimSpace(x[i+1:])}, nil
+}
+
+// metadataCredentials attaches the configured headers, and the bearer token if
+// any, to every RPC.
+type metadataCredentials struct {
+	md map[string]string
+}
+
+// newMetadataCredentials returns nil if there is nothing to attach. The token
+// file is read once, and its content is sent as a bearer token unless an
+// authorization header is set explicitly.
+func newMetadataCredentials(headers []Header, tokenFile string) (*metadataCredentials, error) {
+	md := make(map[string]string)
+	for _, header := range headers {
+		if existing, ok := md[header.Key]; ok {
+			// Repeated keys are joined like HTTP/2 headers
+			md[header.Key] = existing + "," + header.Value
+		} else {
+			md[header.Key] = header.Value
+		}
+	}
+	if tokenFile != "" {
+		bytes, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token file: %v", err)
+		}
+		token := strings.TrimSpace(string(bytes))
+		if token == "" {
+			return nil, fmt.Errorf("token file %v is empty", tokenFile)
+		}
+		if _, ok := md["authorization"]; !ok {
+			md["authorization"] = "Bearer " + token
+		}
+	}
+	if len(md) == 0 {
+		return nil, nil
+	}
+	return &metadataCredentials{md: md}, nil
+}
+
+func (m *metadataCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return m.md, nil
+}
+
+// RequireTransportSecurity allows sending headers over insecure connections,
+// since admin ports are commonly plaintext and the user opted in explicitly.
+func (m *metadataCredentials) RequireTransportSecurity() bool {
+	return false
+}
@@ -0,0 +1,193 @@
+package transport
+
+import (
+	"context"
+
+	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+)
+
+// cursor holds the paging state shared by the channelz iterators. Channelz
+// list RPCs return entities ordered by ID, and the next page starts right
+// after the last ID seen.
+type cursor struct {
+	client   *Client
+	ctx      context.Context
+	start    int64
+	end      bool
+	returned int
+	err      error
+}
+
+// done reports whether the iterator must stop before yielding another entity.
+func (c *cursor) done() bool {
+	return c.err != nil || (c.client.resultLimit > 0 && c.returned >= c.client.resultLimit)
+}
+
+// advance records a fetched page. lastID is the ID of the last entity in the
+// page, or -1 if the page is empty.
+func (c *cursor) advance(lastID int64, end bool) {
+	c.end = end
+	if lastID < 0 {
+		// An empty page that is not the end would never make progress
+		c.end = true
+		return
+	}
+	c.start = lastID + 1
+}
+
+// ChannelIterator pages through the top channels. Call Next until it returns
+// false, then check Err.
+type ChannelIterator struct {
+	cursor
+	page    []*zpb.Channel
+	current *zpb.Channel
+}
+
+// NewChannelIterator returns an iterator starting from the first channel
+func (c *Client) NewChannelIterator(ctx context.Context) *ChannelIterator {
+	return &ChannelIterator{cursor: cursor{client: c, ctx: ctx}}
+}
+
+// Next advances to the next channel, fetching a new page when needed. It
+// returns false when there are no more channels, the limit is reached, or an
+// error occurred.
+func (it *ChannelIterator) Next() bool {
+	if it.done() {
+		return false
+	}
+	for len(it.page) == 0 {
+		if it.end {
+			return false
+		}
+		resp, err := it.client.channelz.GetTopChannels(
+			it.ctx,
+			&zpb.GetTopChannelsRequest{StartChannelId: it.start, MaxResults: it.client.pageSize},
+		)
+		if err != nil {
+			it.err = wrapRPCError(err, "failed to fetch top channels (start=%v)", it.start)
+			return false
+		}
+		it.page = resp.Channel
+		var lastID int64 = -1
+		if n := len(resp.Channel); n > 0 {
+			lastID = resp.Channel[n-1].Ref.ChannelId
+		}
+		it.advance(lastID, resp.End)
+	}
+	it.current, it.page = it.page[0], it.page[1:]
+	it.returned++
+	return true
+}
+
+// Channel returns the current channel
+func (it *ChannelIterator) Channel() *zpb.Channel {
+	return it.current
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *ChannelIterator) Err() error {
+	return it.err
+}
+
+// ServerIterator pages through the servers.
+type ServerIterator struct {
+	cursor
+	page    []*zpb.Server
+	current *zpb.Server
+}
+
+// NewServerIterator returns an iterator starting from the first server
+func (c *Client) NewServerIterator(ctx context.Context) *ServerIterator {
+	return &ServerIterator{cursor: cursor{client: c, ctx: ctx}}
+}
+
+// Next advances to the next server, see ChannelIterator.Next
+func (it *ServerIterator) Next() bool {
+	if it.done() {
+		return false
+	}
+	for len(it.page) == 0 {
+		if it.end {
+			return false
+		}
+		resp, err := it.client.channelz.GetServers(
+			it.ctx,
+			&zpb.GetServersRequest{StartServerId: it.start, MaxResults: it.client.pageSize},
+		)
+		if err != nil {
+			it.err = wrapRPCError(err, "failed to fetch servers (start=%v)", it.start)
+			return false
+		}
+		it.page = resp.Server
+		var lastID int64 = -1
+		if n := len(resp.Server); n > 0 {
+			lastID = resp.Server[n-1].Ref.ServerId
+		}
+		it.advance(lastID, resp.End)
+	}
+	it.current, it.page = it.page[0], it.page[1:]
+	it.returned++
+	return true
+}
+
+// Server returns the current server
+func (it *ServerIterator) Server() *zpb.Server {
+	return it.current
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *ServerIterator) Err() error {
+	return it.err
+}
+
+// ServerSocketIterator pages through the socket references of a server.
+type ServerSocketIterator struct {
+	cursor
+	serverID int64
+	page     []*zpb.SocketRef
+	current  *zpb.SocketRef
+}
+
+// NewServerSocketIterator returns an iterator over the sockets of a server
+func (c *Client) NewServerSocketIterator(ctx context.Context, serverID int64) *ServerSocketIterator {
+	return &ServerSocketIterator{cursor: cursor{client: c, ctx: ctx}, serverID: serverID}
+}
+
+// Next advances to the next socket reference, see ChannelIterator.Next
+func (it *ServerSocketIterator) Next() bool {
+	if it.done() {
+		return false
+	}
+	for len(it.page) == 0 {
+		if it.end {
+			return false
+		}
+		resp, err := it.client.channelz.GetServerSockets(
+			it.ctx,
+			&zpb.GetServerSocketsRequest{ServerId: it.serverID, StartSocketId: it.start, MaxResults: it.client.pageSize},
+		)
+		if err != nil {
+			it.err = wrapRPCError(err, "failed to fetch server sockets (id=%v, start=%v)", it.serverID, it.start)
+			return false
+		}
+		it.page = resp.SocketRef
+		var lastID int64 = -1
+		if n := len(resp.SocketRef); n > 0 {
+			lastID = resp.SocketRef[n-1].SocketId
+		}
+		it.advance(lastID, resp.End)
+	}
+	it.current, it.page = it.page[0], it.page[1:]
+	it.returned++
+	return true
+}
+
+// SocketRef returns the current socket reference
+func (it *ServerSocketIterator) SocketRef() *zpb.SocketRef {
+	return it.current
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *ServerSocketIterator) Err() error {
+	return it.err
+}
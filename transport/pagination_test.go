@@ -0,0 +1,132 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestChannelIterator(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		ids        []int64
+		pageSize   int64
+		limit      int
+		wantIDs    []int64
+		wantStarts []int64
+	}{
+		{name: "no channels", wantStarts: []int64{0}},
+		{name: "one page", ids: []int64{3, 1, 2}, wantIDs: []int64{1, 2, 3}, wantStarts: []int64{0}},
+		{name: "several pages", ids: []int64{1, 2, 5, 9, 10}, pageSize: 2, wantIDs: []int64{1, 2, 5, 9, 10}, wantStarts: []int64{0, 3, 10}},
+		{name: "full last page", ids: []int64{1, 2, 3, 4}, pageSize: 2, wantIDs: []int64{1, 2, 3, 4}, wantStarts: []int64{0, 3}},
+		{name: "limit", ids: []int64{1, 2, 3, 4, 5}, pageSize: 2, limit: 3, wantIDs: []int64{1, 2, 3}, wantStarts: []int64{0, 3}},
+		{name: "limit above the count", ids: []int64{1, 2}, limit: 5, wantIDs: []int64{1, 2}, wantStarts: []int64{0}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newFakeChannelz()
+			for _, id := range test.ids {
+				fake.addChannel(id, nil, nil)
+			}
+			client := NewClientFromStubs(fake, nil, nil, WithPagination(test.pageSize, test.limit))
+			var ids []int64
+			it := client.NewChannelIterator(context.Background())
+			for it.Next() {
+				ids = append(ids, it.Channel().GetRef().GetChannelId())
+			}
+			if err := it.Err(); err != nil {
+				t.Fatalf("Err() = %v", err)
+			}
+			if !reflect.DeepEqual(ids, test.wantIDs) {
+				t.Errorf("channels = %v, want %v", ids, test.wantIDs)
+			}
+			if !reflect.DeepEqual(fake.starts, test.wantStarts) {
+				t.Errorf("pages started at %v, want %v", fake.starts, test.wantStarts)
+			}
+		})
+	}
+}
+
+func TestChannelIteratorEmptyPage(t *testing.T) {
+	// A server returning an empty page without End would loop forever
+	fake := newFakeChannelz()
+	fake.defaultPageSize = 0
+	fake.addChannel(1, nil, nil)
+	client := NewClientFromStubs(fake, nil, nil)
+	it := client.NewChannelIterator(context.Background())
+	if it.Next() {
+		t.Errorf("Next() = true on an empty page")
+	}
+	if err := it.Err(); err != nil {
+		t.Errorf("Err() = %v", err)
+	}
+	if calls := fake.callCount("GetTopChannels"); calls != 1 {
+		t.Errorf("GetTopChannels called %v times, want 1", calls)
+	}
+}
+
+func TestChannelIteratorError(t *testing.T) {
+	fake := newFakeChannelz()
+	for id := int64(1); id <= 4; id++ {
+		fake.addChannel(id, nil, nil)
+	}
+	fake.intercept = func(ctx context.Context, method string) error {
+		if fake.callCount(method) > 1 {
+			return status.Error(codes.PermissionDenied, "denied")
+		}
+		return nil
+	}
+	client := NewClientFromStubs(fake, nil, nil, WithPagination(2, 0))
+	var ids []int64
+	it := client.NewChannelIterator(context.Background())
+	for it.Next() {
+		ids = append(ids, it.Channel().GetRef().GetChannelId())
+	}
+	// The channels of the first page are still yielded
+	if !reflect.DeepEqual(ids, []int64{1, 2}) {
+		t.Errorf("channels = %v, want [1 2]", ids)
+	}
+	if code := status.Code(it.Err()); code != codes.PermissionDenied {
+		t.Errorf("Err() = %v, want a PermissionDenied status", it.Err())
+	}
+	if it.Next() {
+		t.Error("Next() = true after an error")
+	}
+}
+
+func TestServerIterators(t *testing.T) {
+	fake := newFakeChannelz()
+	for id := int64(1); id <= 3; id++ {
+		fake.servers[id] = &zpb.Server{Ref: &zpb.ServerRef{ServerId: id}}
+	}
+	for id := int64(10); id < 15; id++ {
+		fake.serverSockets[2] = append(fake.serverSockets[2], &zpb.SocketRef{SocketId: id})
+	}
+	client := NewClientFromStubs(fake, nil, nil, WithPagination(2, 0))
+	ctx := context.Background()
+	servers, err := client.Servers(ctx)
+	if err != nil {
+		t.Fatalf("Servers() failed: %v", err)
+	}
+	if len(servers) != 3 || fake.callCount("GetServers") != 2 {
+		t.Errorf("Servers() = %v servers in %v pages, want 3 in 2", len(servers), fake.callCount("GetServers"))
+	}
+	refs, err := client.ServerSocketRefs(ctx, 2)
+	if err != nil {
+		t.Fatalf("ServerSocketRefs() failed: %v", err)
+	}
+	var ids []int64
+	for _, ref := range refs {
+		ids = append(ids, ref.SocketId)
+	}
+	if fmt.Sprint(ids) != "[10 11 12 13 14]" {
+		t.Errorf("ServerSocketRefs() = %v, want [10 11 12 13 14]", ids)
+	}
+	if _, err := client.ServerSocketRefs(ctx, 7); status.Code(err) != codes.NotFound {
+		t.Errorf("ServerSocketRefs() of a missing server = %v, want NotFound", err)
+	}
+}
@@ -0,0 +1,188 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ProxyNone disables a proxy set by an earlier matching config block, like
+// ProxyJump none in ssh_config
+const ProxyNone = "none"
+
+type dialFunc func(ctx context.Context, address string) (net.Conn, error)
+
+// proxyDialer returns a dialer tunneling through proxy, which is either an
+// HTTP CONNECT proxy (http://[user:password@]host:port), or an SSH jump host
+// ([ssh://][user@]host[:port], the ProxyJump syntax of ssh_config).
+func proxyDialer(proxy string) (dialFunc, error) {
+	if strings.HasPrefix(proxy, "http://") {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %v: %v", proxy, err)
+		}
+		if u.Port() == "" {
+			u.Host = net.JoinHostPort(u.Hostname(), "80")
+		}
+		return func(ctx context.Context, address string) (net.Conn, error) {
+			return dialHTTPConnect(ctx, u, address)
+		}, nil
+	}
+	if strings.Contains(proxy, "://") && !strings.HasPrefix(proxy, "ssh://") {
+		return nil, fmt.Errorf("unsupported proxy %v, expect http://host:port or [ssh://][user@]host[:port]", proxy)
+	}
+	u, err := url.Parse("ssh://" + strings.TrimPrefix(proxy, "ssh://"))
+	if err != nil || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid SSH jump host %v", proxy)
+	}
+	return func(ctx context.Context, address string) (net.Conn, error) {
+		return dialSSHJump(ctx, u, address)
+	}, nil
+}
+
+// dialHTTPConnect asks the proxy to open a tunnel to address
+func dialHTTPConnect(ctx context.Context, proxy *url.URL, address string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", proxy.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial proxy %v: %v", proxy.Host, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if user := proxy.User; user != nil {
+		password, _ := user.Password()
+		credential := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credential)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send CONNECT to proxy %v: %v", proxy.Host, err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read CONNECT response from proxy %v: %v", proxy.Host, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %v refused to connect to %v: %v", proxy.Host, address, resp.Status)
+	}
+	// The proxy may have sent tunneled bytes right after its response
+	return &bufferedConn{Conn: conn, reader: reader}, nil
+}
+
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// dialSSHJump starts "ssh -W address jump" and speaks through its stdio, so
+// the user's ssh configuration, agent and known hosts all apply.
+func dialSSHJump(ctx context.Context, jump *url.URL, address string) (net.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	args := []string{"-W", address, "-o", "ExitOnForwardFailure=yes"}
+	if port := jump.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+	if user := jump.User.Username(); user != "" {
+		args = append(args, "-l", user)
+	}
+	args = append(args, jump.Hostname())
+	// gRPC cancels the dial context once the connection is up, so the process
+	// cannot be bound to it. It is killed on Close instead, which gRPC calls
+	// when the handshake times out or the client shuts down.
+	processCtx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(processCtx, "ssh", args...)
+	cmd.Stderr = os.Stderr
+	// Pipes from os.Pipe support deadlines, unlike the ones of exec.Cmd
+	childStdin, stdin, err := os.Pipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	stdout, childStdout, err := os.Pipe()
+	if err != nil {
+		cancel()
+		childStdin.Close()
+		stdin.Close()
+		return nil, err
+	}
+	cmd.Stdin, cmd.Stdout = childStdin, childStdout
+	err = cmd.Start()
+	childStdin.Close()
+	childStdout.Close()
+	if err != nil {
+		cancel()
+		stdin.Close()
+		stdout.Close()
+		return nil, fmt.Errorf("failed to start ssh to jump host %v: %v", jump.Host, err)
+	}
+	conn := &commandConn{cmd: cmd, cancel: cancel, stdin: stdin, stdout: stdout, address: address}
+	if err := ctx.Err(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// commandConn adapts the stdio of a child process to a net.Conn
+type commandConn struct {
+	cmd     *exec.Cmd
+	cancel  context.CancelFunc
+	stdin   *os.File
+	stdout  *os.File
+	address string
+}
+
+type commandAddr string
+
+func (a commandAddr) Network() string { return "ssh" }
+func (a commandAddr) String() string  { return string(a) }
+
+func (c *commandConn) Read(b []byte) (int, error)  { return c.stdout.Read(b) }
+func (c *commandConn) Write(b []byte) (int, error) { return c.stdin.Write(b) }
+
+// Close kills the process and waits for it to exit
+func (c *commandConn) Close() error {
+	c.stdin.Close()
+	c.cancel()
+	c.cmd.Wait()
+	return c.stdout.Close()
+}
+
+func (c *commandConn) LocalAddr() net.Addr  { return commandAddr("ssh") }
+func (c *commandConn) RemoteAddr() net.Addr { return commandAddr(c.address) }
+
+func (c *commandConn) SetDeadline(t time.Time) error {
+	if err := c.stdin.SetWriteDeadline(t); err != nil {
+		return err
+	}
+	return c.stdout.SetReadDeadline(t)
+}
+
+func (c *commandConn) SetReadDeadline(t time.Time) error  { return c.stdout.SetReadDeadline(t) }
+func (c *commandConn) SetWriteDeadline(t time.Time) error { return c.stdin.SetWriteDeadline(t) }
@@ -0,0 +1,141 @@
+package transport
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSSH puts an ssh on PATH that echoes its stdin back
+func fakeSSH(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ssh"), []byte("#!/bin/sh\nexec cat\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	t.Cleanup(func() { os.Setenv("PATH", path) })
+}
+
+func TestDialSSHJump(t *testing.T) {
+	fakeSSH(t)
+	conn, err := dialSSHJump(context.Background(), &url.URL{Host: "jump"}, "localhost:50051")
+	if err != nil {
+		t.Fatalf("dialSSHJump() failed: %v", err)
+	}
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	b := make([]byte, 4)
+	if _, err := conn.Read(b); err != nil || string(b) != "ping" {
+		t.Fatalf("Read() = %q, %v, want the echoed ping", b, err)
+	}
+	// Nothing else is coming, so the read times out
+	if err := conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond)); err != nil {
+		t.Fatalf("SetReadDeadline() failed: %v", err)
+	}
+	if _, err := conn.Read(b); !os.IsTimeout(err) {
+		t.Errorf("Read() after the deadline = %v, want a timeout", err)
+	}
+	if err := conn.Close(); err != nil {
+		t.Errorf("Close() failed: %v", err)
+	}
+	if state := conn.(*commandConn).cmd.ProcessState; state == nil {
+		t.Error("Close() returned before ssh exited")
+	}
+	if err := conn.SetDeadline(time.Now()); err == nil {
+		t.Error("SetDeadline() after Close() succeeded, want an error")
+	}
+}
+
+func TestDialSSHJumpCanceled(t *testing.T) {
+	fakeSSH(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := dialSSHJump(ctx, &url.URL{Host: "jump"}, "localhost:50051"); err != context.Canceled {
+		t.Errorf("dialSSHJump() = %v, want %v", err, context.Canceled)
+	}
+}
+
+// connectProxy serves CONNECT requests for want, echoing what is tunneled.
+// Other targets, and requests without the credentials, are refused.
+func connectProxy(t *testing.T, want string) *url.URL {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect || r.Host != want {
+			http.Error(w, "unexpected target", http.StatusForbidden)
+			return
+		}
+		if r.Header.Get("Proxy-Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte("user:secret")) {
+			http.Error(w, "credentials required", http.StatusProxyAuthRequired)
+			return
+		}
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		// Bytes sent along with the response must not be lost
+		buf.WriteString("HTTP/1.1 200 Connection established\r\n\r\nhello")
+		buf.Flush()
+		io.Copy(conn, buf)
+	}))
+	t.Cleanup(server.Close)
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestDialHTTPConnect(t *testing.T) {
+	proxy := connectProxy(t, "backend:50051")
+	authenticated := *proxy
+	authenticated.User = url.UserPassword("user", "secret")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := dialHTTPConnect(ctx, &authenticated, "backend:50051")
+	if err != nil {
+		t.Fatalf("dialHTTPConnect() failed: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	b := make([]byte, 9)
+	if _, err := io.ReadFull(conn, b); err != nil || string(b) != "helloping" {
+		t.Errorf("Read() = %q, %v, want the early bytes then the echoed ping", b, err)
+	}
+
+	for _, test := range []struct {
+		name    string
+		proxy   *url.URL
+		address string
+		want    string
+	}{
+		{"forbidden target", &authenticated, "other:50051", "403 Forbidden"},
+		{"no credentials", proxy, "backend:50051", "407 Proxy Authentication Required"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			conn, err := dialHTTPConnect(ctx, test.proxy, test.address)
+			if err == nil {
+				conn.Close()
+				t.Fatal("dialHTTPConnect() succeeded, want the proxy to refuse")
+			}
+			if !strings.Contains(err.Error(), test.want) {
+				t.Errorf("dialHTTPConnect() = %v, want the %v status", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package transport
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	initialBackoff = 100 * time.Millisecond
+	maxBackoff     = 2 * time.Second
+)
+
+// callPolicy holds the per-RPC deadline and the number of retries applied to
+// every admin RPC of a Client.
+type callPolicy struct {
+	// The deadline of each admin RPC, including its retries; 0 means no deadline
+	timeout time.Duration
+	// How many times an idempotent RPC is retried after failing with UNAVAILABLE
+	maxRetries int
+}
+
+// idempotentMethodPrefixes lists the admin RPCs that only read state, and so
+// can be safely retried.
+var idempotentMethodPrefixes = []string{
+	"/grpc.channelz.v1.Channelz/",
+	"/envoy.service.status.v3.ClientStatusDiscoveryService/FetchClientStatus",
+	"/grpc.health.v1.Health/Check",
+}
+
+func isIdempotent(method string) bool {
+	for _, prefix := range idempotentMethodPrefixes {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// intercept applies the policy to every unary RPC of a connection
+func (p callPolicy) intercept(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return p.call(ctx, method, func(ctx context.Context) error {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	})
+}
+
+// call bounds the RPC by the timeout, and retries it with exponential backoff
+// while the server is UNAVAILABLE, if it is idempotent.
+func (p callPolicy) call(ctx context.Context, method string, rpc func(ctx context.Context) error) error {
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	retries := 0
+	if isIdempotent(method) {
+		retries = p.maxRetries
+	}
+	backoff := initialBackoff
+	for attempt := 0; ; attempt++ {
+		err := rpc(ctx)
+		if err == nil || status.Code(err) != codes.Unavailable || attempt >= retries {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCallPolicyRetries(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		method       string
+		maxRetries   int
+		failures     int
+		code         codes.Code
+		wantAttempts int
+		wantCode     codes.Code
+	}{
+		{"success", "/grpc.channelz.v1.Channelz/GetChannel", 2, 0, codes.Unavailable, 1, codes.OK},
+		{"recovers", "/grpc.channelz.v1.Channelz/GetChannel", 2, 2, codes.Unavailable, 3, codes.OK},
+		{"gives up", "/grpc.channelz.v1.Channelz/GetChannel", 2, 5, codes.Unavailable, 3, codes.Unavailable},
+		{"no retries", "/grpc.channelz.v1.Channelz/GetChannel", 0, 5, codes.Unavailable, 1, codes.Unavailable},
+		{"other codes", "/grpc.health.v1.Health/Check", 2, 5, codes.NotFound, 1, codes.NotFound},
+		{"not idempotent", "/envoy.service.status.v3.ClientStatusDiscoveryService/StreamClientStatus", 2, 5, codes.Unavailable, 1, codes.Unavailable},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			attempts := 0
+			err := callPolicy{maxRetries: test.maxRetries}.call(context.Background(), test.method, func(ctx context.Context) error {
+				attempts++
+				if attempts <= test.failures {
+					return status.Error(test.code, "failed")
+				}
+				return nil
+			})
+			if attempts != test.wantAttempts {
+				t.Errorf("attempts = %v, want %v", attempts, test.wantAttempts)
+			}
+			if code := status.Code(err); code != test.wantCode {
+				t.Errorf("call() = %v, want code %v", err, test.wantCode)
+			}
+		})
+	}
+}
+
+func TestCallPolicyTimeout(t *testing.T) {
+	// The deadline covers the retries, so the backoff is cut short
+	start := time.Now()
+	attempts := 0
+	err := callPolicy{timeout: 50 * time.Millisecond, maxRetries: 100}.call(context.Background(), "/grpc.channelz.v1.Channelz/GetChannel", func(ctx context.Context) error {
+		attempts++
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("the RPC has no deadline")
+		}
+		return status.Error(codes.Unavailable, "down")
+	})
+	if code := status.Code(err); code != codes.Unavailable {
+		t.Errorf("call() = %v, want the last error", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second || attempts > 2 {
+		t.Errorf("call() took %v and %v attempts, want it bounded by the timeout", elapsed, attempts)
+	}
+}
+
+func TestClientFromStubsCallPolicy(t *testing.T) {
+	fake := newFakeChannelz()
+	fake.addChannel(1, nil, nil)
+	fake.intercept = func(ctx context.Context, method string) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Errorf("%v has no deadline", method)
+		}
+		if fake.callCount(method) == 1 {
+			return status.Error(codes.Unavailable, "starting")
+		}
+		return nil
+	}
+	client := NewClientFromStubs(fake, nil, nil, WithCallPolicy(time.Minute, 1))
+	if _, err := client.Channel(context.Background(), 1); err != nil {
+		t.Fatalf("Channel() failed: %v", err)
+	}
+	if calls := fake.callCount("GetChannel"); calls != 2 {
+		t.Errorf("GetChannel called %v times, want 2", calls)
+	}
+}
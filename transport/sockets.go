@@ -0,0 +1,95 @@
+package transport
+
+import (
+	"context"
+
+	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+)
+
+// SocketSide tells whether a socket was opened by a subchannel or accepted by
+// a server
+type SocketSide int
+
+const (
+	ClientSide SocketSide = iota
+	ServerSide
+)
+
+// String returns "client" or "server"
+func (s SocketSide) String() string {
+	if s == ServerSide {
+		return "server"
+	}
+	return "client"
+}
+
+// MarshalText renders the side by name in JSON
+func (s SocketSide) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// SocketEntry is a socket along with its side, or the error fetching it
+type SocketEntry struct {
+	Side   SocketSide
+	ID     int64
+	Socket *zpb.Socket `json:",omitempty"`
+	Err    error       `json:"-"`
+}
+
+// AllSockets gathers the sockets of every subchannel, nested ones included,
+// and the connected sockets of every server; listen sockets are left out.
+// Sockets that fail to be fetched are kept as entries with Err set. The
+// returned error is the first failure that prevented finding more sockets,
+// like a subchannel that could not be fetched.
+func (f *Fetcher) AllSockets(ctx context.Context) ([]SocketEntry, error) {
+	var entries []SocketEntry
+	var firstErr error
+	record := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	seen := make(map[int64]bool)
+	add := func(side SocketSide, id int64, socket *zpb.Socket, err error) {
+		if !seen[id] {
+			seen[id] = true
+			entries = append(entries, SocketEntry{Side: side, ID: id, Socket: socket, Err: err})
+		}
+	}
+	// Gather client sockets
+	channels, err := f.client.Channels(ctx)
+	record(err)
+	trees := make([]*TreeNode, len(channels))
+	errs := make([]error, len(channels))
+	forEach(len(channels), func(i int) {
+		trees[i], errs[i] = f.ChannelTree(ctx, channels[i])
+	})
+	var walk func(node *TreeNode)
+	walk = func(node *TreeNode) {
+		if node.Kind == SocketNode {
+			add(ClientSide, node.ID, node.Socket, node.Err)
+			return
+		}
+		record(node.Err)
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	for _, tree := range trees {
+		walk(tree)
+	}
+	// Gather server sockets
+	servers, err := f.client.Servers(ctx)
+	record(err)
+	serverSocketRefs, errs := f.ServersSocketRefs(ctx, servers)
+	var socketRefs []*zpb.SocketRef
+	for i := range servers {
+		record(errs[i])
+		socketRefs = append(socketRefs, serverSocketRefs[i]...)
+	}
+	sockets, errs := f.Sockets(ctx, socketRefs)
+	for i, ref := range socketRefs {
+		add(ServerSide, ref.SocketId, sockets[i], errs[i])
+	}
+	return entries, firstErr
+}
@@ -0,0 +1,101 @@
+package transport
+
+import (
+	"context"
+
+	csdspb "github.com/envoyproxy/go-control-plane/envoy/service/status/v3"
+	"google.golang.org/grpc"
+	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// The stubs below apply the call policy of a Client created from stubs, like
+// the interceptor does for a Client with a connection. Streaming RPCs are
+// passed through, as the interceptor only sees unary ones.
+
+type policyChannelz struct {
+	zpb.ChannelzClient
+	policy callPolicy
+}
+
+func (s policyChannelz) GetTopChannels(ctx context.Context, in *zpb.GetTopChannelsRequest, opts ...grpc.CallOption) (resp *zpb.GetTopChannelsResponse, err error) {
+	err = s.policy.call(ctx, "/grpc.channelz.v1.Channelz/GetTopChannels", func(ctx context.Context) error {
+		resp, err = s.ChannelzClient.GetTopChannels(ctx, in, opts...)
+		return err
+	})
+	return resp, err
+}
+
+func (s policyChannelz) GetServers(ctx context.Context, in *zpb.GetServersRequest, opts ...grpc.CallOption) (resp *zpb.GetServersResponse, err error) {
+	err = s.policy.call(ctx, "/grpc.channelz.v1.Channelz/GetServers", func(ctx context.Context) error {
+		resp, err = s.ChannelzClient.GetServers(ctx, in, opts...)
+		return err
+	})
+	return resp, err
+}
+
+func (s policyChannelz) GetServer(ctx context.Context, in *zpb.GetServerRequest, opts ...grpc.CallOption) (resp *zpb.GetServerResponse, err error) {
+	err = s.policy.call(ctx, "/grpc.channelz.v1.Channelz/GetServer", func(ctx context.Context) error {
+		resp, err = s.ChannelzClient.GetServer(ctx, in, opts...)
+		return err
+	})
+	return resp, err
+}
+
+func (s policyChannelz) GetServerSockets(ctx context.Context, in *zpb.GetServerSocketsRequest, opts ...grpc.CallOption) (resp *zpb.GetServerSocketsResponse, err error) {
+	err = s.policy.call(ctx, "/grpc.channelz.v1.Channelz/GetServerSockets", func(ctx context.Context) error {
+		resp, err = s.ChannelzClient.GetServerSockets(ctx, in, opts...)
+		return err
+	})
+	return resp, err
+}
+
+func (s policyChannelz) GetChannel(ctx context.Context, in *zpb.GetChannelRequest, opts ...grpc.CallOption) (resp *zpb.GetChannelResponse, err error) {
+	err = s.policy.call(ctx, "/grpc.channelz.v1.Channelz/GetChannel", func(ctx context.Context) error {
+		resp, err = s.ChannelzClient.GetChannel(ctx, in, opts...)
+		return err
+	})
+	return resp, err
+}
+
+func (s policyChannelz) GetSubchannel(ctx context.Context, in *zpb.GetSubchannelRequest, opts ...grpc.CallOption) (resp *zpb.GetSubchannelResponse, err error) {
+	err = s.policy.call(ctx, "/grpc.channelz.v1.Channelz/GetSubchannel", func(ctx context.Context) error {
+		resp, err = s.ChannelzClient.GetSubchannel(ctx, in, opts...)
+		return err
+	})
+	return resp, err
+}
+
+func (s policyChannelz) GetSocket(ctx context.Context, in *zpb.GetSocketRequest, opts ...grpc.CallOption) (resp *zpb.GetSocketResponse, err error) {
+	err = s.policy.call(ctx, "/grpc.channelz.v1.Channelz/GetSocket", func(ctx context.Context) error {
+		resp, err = s.ChannelzClient.GetSocket(ctx, in, opts...)
+		return err
+	})
+	return resp, err
+}
+
+type policyCSDS struct {
+	csdspb.ClientStatusDiscoveryServiceClient
+	policy callPolicy
+}
+
+func (s policyCSDS) FetchClientStatus(ctx context.Context, in *csdspb.ClientStatusRequest, opts ...grpc.CallOption) (resp *csdspb.ClientStatusResponse, err error) {
+	err = s.policy.call(ctx, "/envoy.service.status.v3.ClientStatusDiscoveryService/FetchClientStatus", func(ctx context.Context) error {
+		resp, err = s.ClientStatusDiscoveryServiceClient.FetchClientStatus(ctx, in, opts...)
+		return err
+	})
+	return resp, err
+}
+
+type policyHealth struct {
+	healthpb.HealthClient
+	policy callPolicy
+}
+
+func (s policyHealth) Check(ctx context.Context, in *healthpb.HealthCheckRequest, opts ...grpc.CallOption) (resp *healthpb.HealthCheckResponse, err error) {
+	err = s.policy.call(ctx, "/grpc.health.v1.Health/Check", func(ctx context.Context) error {
+		resp, err = s.HealthClient.Check(ctx, in, opts...)
+		return err
+	})
+	return resp, err
+}
@@ -0,0 +1,142 @@
+package transport
+
+import (
+	"context"
+
+	zpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+)
+
+// NodeKind tells which channelz entity a TreeNode holds
+type NodeKind int
+
+const (
+	ChannelNode NodeKind = iota
+	SubchannelNode
+	SocketNode
+)
+
+// String returns the name of the entity kind
+func (k NodeKind) String() string {
+	switch k {
+	case ChannelNode:
+		return "Channel"
+	case SubchannelNode:
+		return "Subchannel"
+	default:
+		return "Socket"
+	}
+}
+
+// MarshalText renders the kind by name in JSON
+func (k NodeKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// TreeNode is a channel, subchannel or socket along with everything nested
+// under it. Exactly one of Channel, Subchannel and Socket is set, unless
+// fetching the entity failed, in which case Err is set instead.
+type TreeNode struct {
+	Kind       NodeKind
+	ID         int64
+	Channel    *zpb.Channel    `json:",omitempty"`
+	Subchannel *zpb.Subchannel `json:",omitempty"`
+	Socket     *zpb.Socket     `json:",omitempty"`
+	Err        error           `json:"-"`
+	// Cycle is set when the entity is one of its own ancestors. Its children
+	// are not expanded again.
+	Cycle bool `json:",omitempty"`
+	// Child channels first, then subchannels, then sockets
+	Children []*TreeNode `json:",omitempty"`
+}
+
+// treeKey identifies an entity among all kinds, to detect cycles
+type treeKey struct {
+	kind NodeKind
+	id   int64
+}
+
+// ChannelTree expands a fetched channel into the tree of its child channels,
+// subchannels and sockets, recursively. Entities that fail to be fetched are
+// kept as nodes with Err set, and the first such error is returned.
+func (f *Fetcher) ChannelTree(ctx context.Context, channel *zpb.Channel) (*TreeNode, error) {
+	node := &TreeNode{Kind: ChannelNode, ID: channel.GetRef().GetChannelId(), Channel: channel}
+	err := f.expand(ctx, node, map[treeKey]bool{{ChannelNode, node.ID}: true})
+	return node, err
+}
+
+// ChannelTrees expands the channels concurrently, like ChannelTree. The trees
+// and errors are indexed like channels.
+func (f *Fetcher) ChannelTrees(ctx context.Context, channels []*zpb.Channel) ([]*TreeNode, []error) {
+	trees := make([]*TreeNode, len(channels))
+	errs := make([]error, len(channels))
+	forEach(len(channels), func(i int) {
+		trees[i], errs[i] = f.ChannelTree(ctx, channels[i])
+	})
+	return trees, errs
+}
+
+// SubchannelTree fetches a subchannel and expands it like ChannelTree
+func (f *Fetcher) SubchannelTree(ctx context.Context, subchannelID int64) (*TreeNode, error) {
+	node := &TreeNode{Kind: SubchannelNode, ID: subchannelID}
+	if node.Subchannel, node.Err = f.Subchannel(ctx, subchannelID); node.Err != nil {
+		return node, node.Err
+	}
+	err := f.expand(ctx, node, map[treeKey]bool{{SubchannelNode, subchannelID}: true})
+	return node, err
+}
+
+// expand fetches the children of node and expands them concurrently.
+// ancestors holds the entities on the path from the root, node included.
+func (f *Fetcher) expand(ctx context.Context, node *TreeNode, ancestors map[treeKey]bool) error {
+	var channelRefs []*zpb.ChannelRef
+	var subchannelRefs []*zpb.SubchannelRef
+	var socketRefs []*zpb.SocketRef
+	switch node.Kind {
+	case ChannelNode:
+		channelRefs = node.Channel.GetChannelRef()
+		subchannelRefs = node.Channel.GetSubchannelRef()
+	case SubchannelNode:
+		channelRefs = node.Subchannel.GetChannelRef()
+		subchannelRefs = node.Subchannel.GetSubchannelRef()
+		socketRefs = node.Subchannel.GetSocketRef()
+	default:
+		return nil
+	}
+	channels, channelErrs := f.Channels(ctx, channelRefs)
+	for i, ref := range channelRefs {
+		node.Children = append(node.Children, &TreeNode{Kind: ChannelNode, ID: ref.ChannelId, Channel: channels[i], Err: channelErrs[i]})
+	}
+	subchannels, subchannelErrs := f.Subchannels(ctx, subchannelRefs)
+	for i, ref := range subchannelRefs {
+		node.Children = append(node.Children, &TreeNode{Kind: SubchannelNode, ID: ref.SubchannelId, Subchannel: subchannels[i], Err: subchannelErrs[i]})
+	}
+	sockets, socketErrs := f.Sockets(ctx, socketRefs)
+	for i, ref := range socketRefs {
+		node.Children = append(node.Children, &TreeNode{Kind: SocketNode, ID: ref.SocketId, Socket: sockets[i], Err: socketErrs[i]})
+	}
+	errs := make([]error, len(node.Children))
+	forEach(len(node.Children), func(i int) {
+		child := node.Children[i]
+		if child.Err != nil {
+			errs[i] = child.Err
+			return
+		}
+		key := treeKey{child.Kind, child.ID}
+		if ancestors[key] {
+			child.Cycle = true
+			return
+		}
+		path := make(map[treeKey]bool, len(ancestors)+1)
+		for k := range ancestors {
+			path[k] = true
+		}
+		path[key] = true
+		errs[i] = f.expand(ctx, child, path)
+	})
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// describeTree renders a tree on one line, marking cycles with "!" and
+// failures with "?"
+func describeTree(node *TreeNode) string {
+	s := fmt.Sprintf("%v%v", strings.ToLower(node.Kind.String()[:2]), node.ID)
+	switch {
+	case node.Err != nil:
+		return s + "?"
+	case node.Cycle:
+		return s + "!"
+	}
+	if len(node.Children) == 0 {
+		return s
+	}
+	var children []string
+	for _, child := range node.Children {
+		children = append(children, describeTree(child))
+	}
+	return s + "(" + strings.Join(children, " ") + ")"
+}
+
+func TestChannelTree(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		setup func(f *fakeChannelz)
+		want  string
+	}{
+		{
+			name: "nested",
+			setup: func(f *fakeChannelz) {
+				f.addChannel(1, []int64{2}, []int64{3})
+				f.addChannel(2, nil, nil)
+				f.addSubchannel(3, nil, nil, []int64{4, 5})
+			},
+			want: "ch1(ch2 su3(so4 so5))",
+		},
+		{
+			name: "cycle through a subchannel",
+			setup: func(f *fakeChannelz) {
+				f.addChannel(1, nil, []int64{2})
+				f.addSubchannel(2, []int64{1}, nil, nil)
+			},
+			want: "ch1(su2(ch1!))",
+		},
+		{
+			name: "self reference",
+			setup: func(f *fakeChannelz) {
+				f.addChannel(1, []int64{1}, nil)
+			},
+			want: "ch1(ch1!)",
+		},
+		{
+			// An entity reached twice on different paths is not a cycle
+			name: "shared subchannel",
+			setup: func(f *fakeChannelz) {
+				f.addChannel(1, []int64{2}, []int64{3})
+				f.addChannel(2, nil, []int64{3})
+				f.addSubchannel(3, nil, nil, []int64{4})
+			},
+			want: "ch1(ch2(su3(so4)) su3(so4))",
+		},
+		{
+			// Channels and subchannels share the ID space, but not the keys
+			name: "same ID of another kind",
+			setup: func(f *fakeChannelz) {
+				f.addChannel(1, nil, []int64{1})
+				f.addSubchannel(1, nil, nil, nil)
+			},
+			want: "ch1(su1)",
+		},
+		{
+			name: "missing child",
+			setup: func(f *fakeChannelz) {
+				f.addChannel(1, []int64{2}, []int64{3})
+				f.addSubchannel(3, nil, nil, nil)
+			},
+			want: "ch1(ch2? su3)",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newFakeChannelz()
+			test.setup(fake)
+			f := NewClientFromStubs(fake, nil, nil).NewFetcher()
+			tree, err := f.ChannelTree(context.Background(), fake.channels[1])
+			if got := describeTree(tree); got != test.want {
+				t.Errorf("ChannelTree() = %v, want %v", got, test.want)
+			}
+			if wantErr := strings.Contains(test.want, "?"); (err != nil) != wantErr {
+				t.Errorf("ChannelTree() error = %v, want an error: %v", err, wantErr)
+			}
+		})
+	}
+}
+
+func TestSubchannelTree(t *testing.T) {
+	fake := newFakeChannelz()
+	fake.addSubchannel(1, nil, []int64{2}, []int64{3})
+	fake.addSubchannel(2, nil, []int64{1}, nil)
+	f := NewClientFromStubs(fake, nil, nil).NewFetcher()
+	ctx := context.Background()
+	tree, err := f.SubchannelTree(ctx, 1)
+	if err != nil {
+		t.Fatalf("SubchannelTree() failed: %v", err)
+	}
+	if got, want := describeTree(tree), "su1(su2(su1!) so3)"; got != want {
+		t.Errorf("SubchannelTree() = %v, want %v", got, want)
+	}
+	tree, err = f.SubchannelTree(ctx, 9)
+	if status.Code(err) != codes.NotFound || describeTree(tree) != "su9?" {
+		t.Errorf("SubchannelTree() of a missing subchannel = %v, %v, want NotFound", describeTree(tree), err)
+	}
+}